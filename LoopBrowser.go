@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// BROWSERHELP follows the directory in the status bar while browsing
+const BROWSERHELP = "[n]ew [r]ename [d]elete"
+
+// DirectoryLoop browses the active browser buffer's directory. Up/Down pick an entry, Enter opens it,
+// Backspace or Left goes to the parent, n creates a file (or a directory if the name ends in "/"),
+// r renames and d deletes the entry. Esc goes back to the command line
+func DirectoryLoop() {
+	if err := RefreshDirectory(); err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt read the directory: %s", err.Error())
+	}
+
+	for {
+		buffer := BUFFERS[CURRENTBUFFER]
+		if buffer.Directory == "" {
+			// Something opened a file from here
+			return
+		}
+
+		TERMINAL.Clear()
+		DisplayBuffer()
+		highlightCursorLine()
+		if STATUSMESSAGE == "" {
+			STATUSMESSAGE = BufferName(buffer) + "  " + BROWSERHELP
+		}
+		DisplayStatus()
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			STATUSMESSAGE = ""
+			position := CursorPosition()
+			entry := buffer.entries[position.Line]
+			path := filepath.Join(buffer.Directory, entry.Name)
+
+			switch ev.Key() {
+			case tcell.KeyUp:
+				MoveCursorTo(position.Line-1, 0)
+			case tcell.KeyDown:
+				MoveCursorTo(position.Line+1, 0)
+			case tcell.KeyPgUp:
+				MoveCursorTo(position.Line-ROWS, 0)
+			case tcell.KeyPgDn:
+				MoveCursorTo(position.Line+ROWS, 0)
+			case tcell.KeyHome:
+				MoveCursorTo(0, 0)
+			case tcell.KeyEnd:
+				MoveCursorTo(len(TEXTBUFFER)-1, 0)
+			case tcell.KeyEnter:
+				if entry.IsDir {
+					browseTo(path, "")
+				} else {
+					openFileByName(path)
+					return
+				}
+			case tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyLeft:
+				browseTo(filepath.Dir(buffer.Directory), filepath.Base(buffer.Directory))
+			case tcell.KeyDelete:
+				deleteEntry(path, entry)
+			case tcell.KeyEscape:
+				return
+			case tcell.KeyRune:
+				switch ev.Rune() {
+				case 'n':
+					createEntry(buffer.Directory)
+				case 'r':
+					renameEntry(path, entry)
+				case 'd':
+					deleteEntry(path, entry)
+				}
+			}
+		case *EventTick:
+			continue
+		}
+	}
+}
+
+// highlightCursorLine reverses the cursor's line in the active pane, marking the picked entry
+func highlightCursorLine() {
+	row := ACTIVEPANE.Y + CURSORY
+	for col := ACTIVEPANE.X + LINECOUNTWIDTH; col < ACTIVEPANE.X+ACTIVEPANE.Width; col++ {
+		char, combining, style, _ := TERMINAL.GetContent(col, row)
+		TERMINAL.SetContent(col, row, char, combining, style.Reverse(true))
+	}
+}
+
+// refuseDirectory tells the user a command doesn't work on a directory listing, returning true if the active buffer is one
+func refuseDirectory(command string) bool {
+	if BUFFERS[CURRENTBUFFER].Directory == "" {
+		return false
+	}
+	STATUSMESSAGE = fmt.Sprintf("%s doesn't work on a directory listing", command)
+	return true
+}
+
+// browseTo shows another directory in the active browser buffer, with the cursor on the entry named select if there is one
+func browseTo(dir, selectName string) {
+	buffer := BUFFERS[CURRENTBUFFER]
+	entries, err := ListDirectory(dir)
+	if err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt read the directory: %s", err.Error())
+		return
+	}
+	buffer.Directory = dir
+	buffer.entries = entries
+	TEXTBUFFER = browserLines(entries)
+	line := 0
+	for i, entry := range entries {
+		if entry.Name == selectName {
+			line = i
+		}
+	}
+	MoveCursorTo(line, 0)
+}
+
+// createEntry asks for a name and creates an empty file, or a directory if the name ends in "/"
+func createEntry(dir string) {
+	name, ok := TextPromptLoop("New file (end with / for a directory):", "")
+	if !ok || strings.TrimRight(name, "/") == "" {
+		return
+	}
+	path := filepath.Join(dir, name)
+	var err error
+	if strings.HasSuffix(name, "/") {
+		err = os.MkdirAll(path, 0755)
+	} else {
+		var file *os.File
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = file.Close()
+		}
+	}
+	if err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt create %s: %s", name, err.Error())
+		return
+	}
+	browseTo(dir, strings.Split(strings.TrimRight(name, "/"), "/")[0])
+}
+
+// renameEntry asks for a new name for an entry and renames it, after confirming when that replaces a file
+func renameEntry(path string, entry BrowserEntry) {
+	if entry.Name == ".." || entryOpen(path) {
+		return
+	}
+	name, ok := TextPromptLoop("Rename "+entry.Name+" to:", entry.Name)
+	if !ok || name == "" || name == entry.Name {
+		return
+	}
+	dir := filepath.Dir(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Lstat(target); err == nil {
+		if ChoiceLoop(name+" already exists!", []string{"overwrite", "cancel"}) != 0 {
+			return
+		}
+	}
+	if err := os.Rename(path, target); err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt rename %s: %s", entry.Name, err.Error())
+		return
+	}
+	browseTo(dir, filepath.Base(target))
+}
+
+// deleteEntry deletes a file or an empty directory after confirmation
+func deleteEntry(path string, entry BrowserEntry) {
+	if entry.Name == ".." || entryOpen(path) {
+		return
+	}
+	if ChoiceLoop("Delete "+entry.Name+"?", []string{"delete", "cancel"}) != 0 {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt delete %s: %s", entry.Name, err.Error())
+		return
+	}
+	dir := filepath.Dir(path)
+	line := CursorPosition().Line
+	browseTo(dir, "")
+	MoveCursorTo(line, 0)
+}
+
+// entryOpen reports, through the status bar, whether a file is open in a buffer.
+// Open files aren't renamed or deleted from under their buffer
+func entryOpen(path string) bool {
+	storeActiveBuffer()
+	for _, buffer := range BUFFERS {
+		if buffer.SourceFile == "" {
+			continue
+		}
+		if open, err := filepath.Abs(buffer.SourceFile); err == nil && open == path {
+			STATUSMESSAGE = filepath.Base(path) + " is open in a buffer"
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// BufferListLoop lists the open buffers. Enter switches to the highlighted one, Esc goes back
+func BufferListLoop() {
+	storeActiveBuffer()
+	selected := CURRENTBUFFER
+
+	for {
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)-1, STYLES.MSGSTYLE, "Buffers:")
+		for i, buffer := range BUFFERS {
+			marker := "   "
+			if buffer.Modified {
+				marker = "[+]"
+			}
+			line := fmt.Sprintf(" %d %s %s ", i+1, marker, BufferName(buffer))
+			style := STYLES.MSGSTYLE
+			if i == selected {
+				style = style.Reverse(true)
+			}
+			PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+i, style, line)
+		}
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyUp:
+				if selected > 0 {
+					selected--
+				}
+			case tcell.KeyDown:
+				if selected < len(BUFFERS)-1 {
+					selected++
+				}
+			case tcell.KeyEnter:
+				SwitchBuffer(selected)
+				return
+			case tcell.KeyEscape:
+				return
+			}
+		}
+	}
+}
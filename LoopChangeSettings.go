@@ -57,6 +57,9 @@ func ChangeSettingsLoop() {
 		event := TERMINAL.PollEvent()
 		switch ev := event.(type) {
 
+		case *EventTick:
+			// Nothing changed, so there is nothing to save or redraw
+			continue
 		case *tcell.EventKey:
 			mod, key := ev.Modifiers(), ev.Key()
 			if mod == tcell.ModNone {
@@ -148,9 +151,9 @@ func ChangeSettingsLoop() {
 		err := SaveSettings(currentSettings)
 		if err != nil {
 			// Show error message
-			PrintMessage(0, ROWS-1, tcell.ColorRed, tcell.ColorDefault, "Error saving settings")
+			PrintMessage(0, SCREENROWS-2, tcell.ColorRed, tcell.ColorDefault, "Error saving settings")
 			TERMINAL.Show()
-			TERMINAL.PollEvent() // Wait for user input
+			WaitForKey() // Wait for user input
 		}
 
 		// Pass current color selection to display functions for live preview
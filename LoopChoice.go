@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// ChoiceLoop shows a message with a list of choices and waits for one to be picked.
+// A choice is picked by typing its first letter, which is shown in brackets.
+// Returns the index of the picked choice, or -1 if Esc was pressed
+func ChoiceLoop(message string, choices []string) int {
+	var labels []string
+	for _, choice := range choices {
+		labels = append(labels, "["+choice[:1]+"]"+choice[1:])
+	}
+
+	for {
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS / 2), STYLES.MSGSTYLE, message)
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+1, STYLES.MSGSTYLE, strings.Join(labels, "  "))
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			if ev.Key() == tcell.KeyEscape {
+				return -1
+			}
+			if ev.Key() == tcell.KeyRune {
+				pressed := unicode.ToLower(ev.Rune())
+				for i, choice := range choices {
+					if unicode.ToLower([]rune(choice)[0]) == pressed {
+						return i
+					}
+				}
+			}
+		}
+	}
+}
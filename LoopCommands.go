@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// COMMANDS are the commands of the status bar, in the order the palette lists them.
+// They are filled in by init, since some of them open the palette that lists them
+var COMMANDS []*Command
+
+func init() {
+	COMMANDS = []*Command{
+		{Name: "write", Description: "Edit the text, Esc comes back", MaxArgs: 0, Run: func(args []string) {
+			if BUFFERS[CURRENTBUFFER].Directory != "" {
+				DirectoryLoop()
+				return
+			}
+			WriteLoop()
+		}},
+		{Name: "open", Usage: "[file ...]", Description: "Open files, or find one", MaxArgs: -1, Files: true, Run: func(args []string) {
+			if len(args) == 0 {
+				OpenLoop()
+				return
+			}
+			openArguments(args)
+		}},
+		{Name: "save", Usage: "[file]", Description: "Save the buffer", MaxArgs: 1, Files: true, Run: func(args []string) {
+			if refuseDirectory("save") {
+				return
+			}
+			if len(args) == 0 {
+				saveCurrentState()
+				return
+			}
+			saveAsArgument(args[0])
+		}},
+		{Name: "saveas", Usage: "[file]", Description: "Save the buffer under another name", MaxArgs: 1, Files: true, Run: func(args []string) {
+			if refuseDirectory("saveas") {
+				return
+			}
+			if len(args) == 0 {
+				SOURCEFILE = SaveAsLoop()
+				return
+			}
+			saveAsArgument(args[0])
+		}},
+		{Name: "quit", Description: "Quit, asking about unsaved changes", MaxArgs: 0, Run: func(args []string) {
+			if confirmQuit() {
+				exitEditor(EXITOK)
+			}
+		}},
+		{Name: "palette", Description: "List the commands to pick one", MaxArgs: 0, Run: func(args []string) {
+			PaletteLoop()
+		}},
+		{Name: "undo", Description: "Undo the last change", MaxArgs: 0, Run: func(args []string) {
+			Undo()
+		}},
+		{Name: "redo", Description: "Redo the last undone change", MaxArgs: 0, Run: func(args []string) {
+			Redo()
+		}},
+		{Name: "clear", Description: "Empty the buffer", MaxArgs: 0, Run: func(args []string) {
+			if !confirmDiscardChanges() {
+				return
+			}
+			TEXTBUFFER = [][]rune{{}}
+			HISTORY.Reset()
+			MODIFIED = false
+			OFFSETX = 0
+			OFFSETY = 0
+			CURSORX = LINECOUNTWIDTH
+			CURSORY = 0
+			ShowCursor()
+		}},
+		{Name: "reload", Description: "Read the file again from disk", MaxArgs: 0, Run: func(args []string) {
+			if SOURCEFILE != "" && confirmDiscardChanges() {
+				reloadFromDisk()
+			}
+		}},
+		{Name: "recover", Description: "Recover unsaved changes from swap files", MaxArgs: 0, Run: func(args []string) {
+			RecoverLoop()
+		}},
+		{Name: "ro", Description: "Toggle read-only for the buffer", MaxArgs: 0, Run: func(args []string) {
+			if refuseDirectory("ro") {
+				return
+			}
+			READONLY = !READONLY
+			if READONLY {
+				STATUSMESSAGE = "Buffer is read-only"
+			} else {
+				STATUSMESSAGE = "Buffer can be edited"
+			}
+		}},
+		{Name: "lf", Description: "Use LF line endings", MaxArgs: 0, Run: func(args []string) {
+			setLineEnding("\n")
+		}},
+		{Name: "crlf", Description: "Use CRLF line endings", MaxArgs: 0, Run: func(args []string) {
+			setLineEnding("\r\n")
+		}},
+		{Name: "ls", Description: "List the open buffers", MaxArgs: 0, Run: func(args []string) {
+			BufferListLoop()
+		}},
+		{Name: "b", Usage: "<number>", Description: "Switch to a buffer, numbered as in ls", MaxArgs: 1, Run: func(args []string) {
+			if len(args) != 1 {
+				STATUSMESSAGE = "Usage: b <number>"
+				return
+			}
+			index, err := strconv.Atoi(args[0])
+			if err != nil || index < 1 || index > len(BUFFERS) {
+				STATUSMESSAGE = fmt.Sprintf("No buffer %s, see ls", args[0])
+				return
+			}
+			SwitchBuffer(index - 1)
+		}},
+		{Name: "bn", Description: "Switch to the next buffer", MaxArgs: 0, Run: func(args []string) {
+			NextBuffer()
+		}},
+		{Name: "bp", Description: "Switch to the previous buffer", MaxArgs: 0, Run: func(args []string) {
+			PrevBuffer()
+		}},
+		{Name: "bd", Description: "Close the buffer", MaxArgs: 0, Run: func(args []string) {
+			if confirmDiscardChanges() {
+				CloseBuffer()
+			}
+		}},
+		{Name: "recent", Description: "List recently used files", MaxArgs: 0, Run: func(args []string) {
+			RecentLoop()
+		}},
+		{Name: "split", Description: "Split the pane in two, one above the other", MaxArgs: 0, Run: func(args []string) {
+			SplitPane(false)
+		}},
+		{Name: "vsplit", Description: "Split the pane in two, side by side", MaxArgs: 0, Run: func(args []string) {
+			SplitPane(true)
+		}},
+		{Name: "focus", Description: "Move to the next pane", MaxArgs: 0, Run: func(args []string) {
+			NextPane()
+		}},
+		{Name: "close", Description: "Close the pane", MaxArgs: 0, Run: func(args []string) {
+			ClosePane()
+		}},
+		{Name: "tree", Description: "Show or hide the file tree", MaxArgs: 0, Run: func(args []string) {
+			ToggleSidebar()
+		}},
+		{Name: "sidebar", Description: "Move to the file tree, showing it", MaxArgs: 0, Run: func(args []string) {
+			SidebarLoop()
+		}},
+		{Name: "visual", Description: "Change the colors", MaxArgs: 0, Run: func(args []string) {
+			ChangeSettingsLoop()
+		}},
+		{Name: "autosave", Usage: "[off|focus|seconds]", Description: "Show or change autosave", MaxArgs: 1, Run: setAutosave},
+		{Name: "keys", Description: "List the key bindings", MaxArgs: 0, Run: func(args []string) {
+			KeysLoop()
+		}},
+		{Name: "vim", Description: "Turn vim keys on or off", MaxArgs: 0, Run: func(args []string) {
+			SetVimKeys(!VIM.Enabled)
+			if VIM.Enabled {
+				STATUSMESSAGE = "Vim keys on, : runs commands"
+			} else {
+				STATUSMESSAGE = "Vim keys off"
+			}
+		}},
+		{Name: "alias", Usage: "[name [command]]", Description: "List, show or define aliases", MaxArgs: -1, Run: setAlias},
+		{Name: "unalias", Usage: "<name>", Description: "Remove an alias", MaxArgs: 1, Run: removeAlias},
+		{Name: "update", Description: "Update STE from git", MaxArgs: 0, Run: func(args []string) {
+			UpdateFromGIT()
+		}},
+	}
+}
+
+// executeCommand runs a command parsed from the status bar. Commands that take a file or a value
+// accept it as an argument, and the ones that prompt for it do so when it's left out
+func executeCommand(name string, args []string) {
+	command := FindCommand(name)
+	if command == nil {
+		STATUSMESSAGE = fmt.Sprintf("Unknown command: %s", name)
+		return
+	}
+	if command.MaxArgs >= 0 && len(args) > command.MaxArgs {
+		if command.Usage == "" {
+			STATUSMESSAGE = fmt.Sprintf("%s takes no arguments", name)
+		} else {
+			STATUSMESSAGE = fmt.Sprintf("Usage: %s %s", name, command.Usage)
+		}
+		return
+	}
+	command.Run(args)
+}
+
+// openArguments opens each file named after open, which may end in :line[:col] like on the command line.
+// Files that don't exist yet are created on the first save
+func openArguments(args []string) {
+	for _, arg := range args {
+		file := parseFileArg(ExpandPath(arg))
+		if !openFileArg(file, false) {
+			return
+		}
+		AddPromptHistory("path", file.Path)
+	}
+	if BUFFERS[CURRENTBUFFER].Directory != "" {
+		DirectoryLoop()
+	}
+}
+
+// saveAsArgument saves the active buffer under the file named after save or saveas
+func saveAsArgument(filename string) {
+	filename = ExpandPath(filename)
+	if err := saveBufferAs(filename); err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt save %s: %s", filename, err.Error())
+		return
+	}
+	SOURCEFILE = filename
+}
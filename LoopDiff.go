@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+)
+
+// DiffLoop shows the output of DiffLines full screen until Esc, Enter or q is pressed
+func DiffLoop(title string, diff []string) {
+	offset := 0
+
+	for {
+		width, height := TERMINAL.Size()
+		// The first row holds the title
+		visibleRows := height - 1
+		maxOffset := len(diff) - visibleRows
+		if maxOffset < 0 {
+			maxOffset = 0
+		}
+		if offset > maxOffset {
+			offset = maxOffset
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		TERMINAL.Clear()
+		for col := 0; col < width; col++ {
+			TERMINAL.SetContent(col, 0, ' ', nil, STYLES.STATUSSTYLE)
+		}
+		PrintMessageStyle(1, 0, STYLES.STATUSSTYLE, title+"  (Esc to close)")
+		for row := 0; row < visibleRows && offset+row < len(diff); row++ {
+			line := diff[offset+row]
+			style := STYLES.MAINSTYLE
+			if len(line) > 0 && line[0] == '-' {
+				style = style.Foreground(tcell.ColorRed)
+			} else if len(line) > 0 && line[0] == '+' {
+				style = style.Foreground(tcell.ColorGreen)
+			}
+			PrintMessageStyle(0, row+1, style, line)
+		}
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyUp:
+				offset--
+			case tcell.KeyDown:
+				offset++
+			case tcell.KeyPgUp:
+				offset -= visibleRows
+			case tcell.KeyPgDn:
+				offset += visibleRows
+			case tcell.KeyHome:
+				offset = 0
+			case tcell.KeyEnd:
+				offset = maxOffset
+			case tcell.KeyEscape, tcell.KeyEnter:
+				return
+			case tcell.KeyRune:
+				if ev.Rune() == 'q' {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+)
+
+// checkExternalChange warns once about each change made to the active buffer's file by something else,
+// offering to reload it, overwrite it with the buffer, or look at the differences first
+func checkExternalChange() {
+	if SOURCEFILE == "" {
+		return
+	}
+	current, changed := diskChanged(SOURCEFILE, DISKSTATE)
+	if !changed {
+		// Only the timestamp moved, remembering it saves hashing the file on every check
+		DISKSTATE = current
+		return
+	}
+	if current == diskWarned {
+		return
+	}
+	diskWarned = current
+
+	if resolveExternalChange(current) {
+		saveCurrentState()
+	}
+}
+
+// confirmExternalOverwrite is checked before saving. If the file changed on disk since it was read,
+// the user picks between reloading it, overwriting it or cancelling. Returns true if the save should go ahead
+func confirmExternalOverwrite() bool {
+	if SOURCEFILE == "" {
+		return true
+	}
+	current, changed := diskChanged(SOURCEFILE, DISKSTATE)
+	if !changed {
+		return true
+	}
+	diskWarned = current
+	return resolveExternalChange(current)
+}
+
+// resolveExternalChange asks what to do about the file changing on disk.
+// Returns true if the buffer should be written over it
+func resolveExternalChange(current DiskState) bool {
+	message := fmt.Sprintf("%s changed on disk!", SOURCEFILE)
+	for {
+		switch ChoiceLoop(message, []string{"reload", "overwrite", "diff"}) {
+		case 0:
+			reloadFromDisk()
+			return false
+		case 1:
+			// The buffer wins, so the current version is what it replaces
+			DISKSTATE = current
+			return true
+		case 2:
+			textLines := make([]string, len(TEXTBUFFER))
+			for i, line := range TEXTBUFFER {
+				textLines[i] = string(line)
+			}
+			DiffLoop("Changes on disk to "+SOURCEFILE, DiffLines(textLines, diskLines(SOURCEFILE)))
+		default:
+			return false
+		}
+	}
+}
+
+// reloadFromDisk replaces the active buffer with its file as it is on disk, dropping unsaved changes
+func reloadFromDisk() {
+	textBuffer, format, err := OpenFile(SOURCEFILE)
+	if err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt reload the file: %s", err.Error())
+		return
+	}
+	position := CursorPosition()
+	TEXTBUFFER = textBuffer
+	FILEFORMAT = format
+	DISKSTATE = ReadDiskState(SOURCEFILE)
+	HISTORY.Reset()
+	MODIFIED = false
+	MoveCursorTo(position.Line, position.Col)
+}
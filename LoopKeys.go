@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// KeysLoop lists the key bindings of command mode and of WriteLoop, with the commands they run.
+// Up/Down scroll, Esc or Enter goes back
+func KeysLoop() {
+	var lines []string
+	for _, keymap := range []struct {
+		Title  string
+		Keymap Keymap
+	}{{"Command mode", COMMANDKEYS}, {"Write mode", WRITEKEYS}} {
+		lines = append(lines, keymap.Title+":")
+		for _, sequence := range keymap.Keymap.Sequences() {
+			lines = append(lines, fmt.Sprintf("  %-18s %s", sequence, keymap.Keymap[sequence]))
+		}
+	}
+	scroll := 0
+
+	for {
+		visibleRows := SCREENROWS - 1 - (SCREENROWS / 2)
+		if visibleRows < 1 {
+			visibleRows = 1
+		}
+		if scroll > len(lines)-visibleRows {
+			scroll = len(lines) - visibleRows
+		}
+		if scroll < 0 {
+			scroll = 0
+		}
+
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)-1, STYLES.MSGSTYLE, "Key bindings:")
+		for row := 0; row < visibleRows && scroll+row < len(lines); row++ {
+			PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+row, STYLES.MSGSTYLE, " "+lines[scroll+row]+" ")
+		}
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyUp:
+				scroll--
+			case tcell.KeyDown:
+				scroll++
+			case tcell.KeyEnter, tcell.KeyEscape:
+				return
+			}
+		}
+	}
+}
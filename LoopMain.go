@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -18,11 +19,25 @@ var (
 var OFFSETY = 0
 var OFFSETX = 0
 var SOURCEFILE string
+
+// FILTERBUFFER is the buffer written to stdout on quit when running with --filter
+var FILTERBUFFER *Buffer
+
+// READONLY marks the active buffer as not to be edited. It is set for files without write permission,
+// by --readonly, or toggled with the ro command
+var READONLY = false
+
+// MODIFIED is set by every edit to TEXTBUFFER and cleared when it is written to a file
+var MODIFIED = false
 var TEXTBUFFER = [][]rune{
 	{},
 }
 
-var INPUTBUFFER []rune
+// INPUTBUFFER is the command typed into the status bar, with the history of earlier commands
+var INPUTBUFFER = &PromptInput{}
+
+// STATUSMESSAGE is shown in the status bar while nothing is typed, until the next key press
+var STATUSMESSAGE string
 var LINECOUNTWIDTH = 3
 
 type StyleSet struct {
@@ -47,81 +62,261 @@ var TERMINAL, bootErr = tcell.NewScreen()
 var MAXWIDTH = 78
 
 func runEditor() {
+	options, err := ParseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ste: %v\nRun 'ste --help' for usage.\n", err)
+		os.Exit(EXITUSAGE)
+	}
+	// Like vi and view, running STE through a link named view opens everything read-only
+	program := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if program == "view" {
+		options.ReadOnly = true
+	}
+	if options.Help {
+		fmt.Print(USAGE)
+		os.Exit(EXITOK)
+	}
+	if options.Version {
+		fmt.Printf("ste %s\n", VERSION)
+		os.Exit(EXITOK)
+	}
+
+	CONFIGPATH = options.Config
+	settings, err := LoadSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading settings: %v\n", err)
+		os.Exit(EXITERROR)
+	}
+	ApplySettings(settings)
+	// The command history lives next to config.json, so it is read once --config is known
+	INPUTBUFFER = NewPromptInput("command")
+	if options.Theme != "" && !ApplyTheme(options.Theme) {
+		fmt.Fprintf(os.Stderr, "ste: unknown theme %q\nRun 'ste --help' for usage.\n", options.Theme)
+		os.Exit(EXITUSAGE)
+	}
+
+	// Piped input is read before the terminal starts. tcell reads keys from the tty itself, not stdin,
+	// so the editor still takes input once stdin is used up
+	stdinText, stdinFormat := [][]rune{{}}, DefaultFileFormat()
+	if options.ReadsStdin() {
+		stdinText, stdinFormat, err = ReadBuffer(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ste: failed to read stdin: %v\n", err)
+			os.Exit(EXITERROR)
+		}
+	}
+
 	TERMINAL.Init()
 	if bootErr != nil {
 		fmt.Println(bootErr)
 		fmt.Println("Error initializing termbox. STE could not launch. Error message seen above, gl troubleshooting!")
 		TERMINAL.PollEvent()
-		os.Exit(1)
+		os.Exit(EXITERROR)
 	}
 
-	settings, err := LoadSettings()
-	if err != nil {
-		fmt.Printf("Error loading settings: %v\n", err)
-		return
+	// On a crash, unsaved changes go to the swap files, the locks are released and the terminal is restored before the panic is printed
+	defer func() {
+		if r := recover(); r != nil {
+			FlushSwapFiles()
+			ReleaseAllLocks()
+			TERMINAL.Fini()
+			panic(r)
+		}
+	}()
+
+	TERMINAL.EnableFocus()
+	StartTicker()
+	updateScreenSize()
+
+	if options.Restore {
+		restoreSession(options.ReadOnly)
 	}
-	ApplySettings(settings)
-	if len(os.Args) == 2 {
-		workingPath, err := os.Getwd()
-		if err != nil {
-			fmt.Print(err, "Error getting working directory, what happened?")
+	// The first file named that opens is the one shown
+	first := -1
+	for _, file := range options.Files {
+		if file.Stdin {
+			AddBuffer(stdinText, stdinFormat, "")
+			READONLY = READONLY || options.ReadOnly
+			if file.Line > 0 {
+				MoveCursorTo(file.Line-1, file.Col-1)
+			}
+		} else if !openFileArg(file, options.ReadOnly) {
+			continue
 		}
-		totalPath := filepath.Join(workingPath, os.Args[1])
-		TEXTBUFFER, err = OpenFile(totalPath)
-		if err != nil {
-			fmt.Println("Couldnt open the file", err, " , please check if the file still exists")
+		if first < 0 {
+			first = CURRENTBUFFER
 		}
-		SOURCEFILE = totalPath
+	}
+	if first >= 0 {
+		SwitchBuffer(first)
+	}
+	if options.Filter {
+		FILTERBUFFER = BUFFERS[CURRENTBUFFER]
+	}
+
+	RecoverLoop()
+	for _, command := range options.Commands {
+		runCommand(command)
+	}
+	// ste . starts out browsing
+	if BUFFERS[CURRENTBUFFER].Directory != "" {
+		DirectoryLoop()
 	}
 	mainEditorLoop()
 }
 
+// restoreSession reopens the files that were open when STE last exited, at their last positions
+func restoreSession(readOnly bool) {
+	state := LoadRecent()
+	current := -1
+	for i, path := range state.Session {
+		// Files that are gone since aren't brought back as empty buffers
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if openFileArg(FileArg{Path: path}, readOnly) && i == state.Current {
+			current = CURRENTBUFFER
+		}
+	}
+	if current >= 0 {
+		SwitchBuffer(current)
+	}
+}
+
+// openFileArg opens a file from the command line in a new buffer, placing the cursor where it asked.
+// Returns false if it wasn't opened
+func openFileArg(file FileArg, readOnly bool) bool {
+	path, err := filepath.Abs(file.Path)
+	if err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt open %s: %s", file.Path, err.Error())
+		return false
+	}
+	if isDirectory(path) {
+		if err := OpenDirectory(path); err != nil {
+			STATUSMESSAGE = fmt.Sprintf("Couldnt open the directory: %s", err.Error())
+			return false
+		}
+		return true
+	}
+	if index := FindBuffer(path); index >= 0 {
+		SwitchBuffer(index)
+	} else {
+		textBuffer, format, err := OpenFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			// No buffer is made, so a failed read can't be saved over the file
+			STATUSMESSAGE = fmt.Sprintf("Couldnt open the file: %s", err.Error())
+			return false
+		}
+		// A file that doesn't exist yet is created on the first save
+		if !AddBuffer(textBuffer, format, path) {
+			return false
+		}
+		READONLY = READONLY || readOnly
+	}
+	if file.Line > 0 {
+		MoveCursorTo(file.Line-1, file.Col-1)
+	}
+	return true
+}
+
+// exitEditor saves the session for --restore, removes the swap and lock files, restores the terminal and exits.
+// In filter mode the filter buffer is written to stdout once the terminal is back to normal
+func exitEditor(code int) {
+	SaveSession()
+	RemoveAllSwapFiles()
+	ReleaseAllLocks()
+	TERMINAL.Fini()
+	if FILTERBUFFER != nil && indexOfBuffer(FILTERBUFFER) >= 0 {
+		if err := writeBuffer(os.Stdout, FILTERBUFFER.TextBuffer, FILTERBUFFER.Format); err != nil {
+			fmt.Fprintf(os.Stderr, "ste: failed to write to stdout: %v\n", err)
+			code = EXITERROR
+		}
+	}
+	os.Exit(code)
+}
+
+// runCommand runs a status bar command as if it had been typed
+func runCommand(command string) {
+	typed := INPUTBUFFER
+	INPUTBUFFER = &PromptInput{}
+	INPUTBUFFER.Set(command)
+	handleCommand()
+	INPUTBUFFER = typed
+}
+
 func mainEditorLoop() {
-	CURSORX = LINECOUNTWIDTH
+	if CURSORX < LINECOUNTWIDTH {
+		CURSORX = LINECOUNTWIDTH
+	}
 	for {
-		COLS, ROWS = TERMINAL.Size()
-		//Ive forgotten why this is 2, one for buffer, but why another?
-		//When 1, status bar is gone, so idk man
-		ROWS -= 2
-		COLS -= LINECOUNTWIDTH
-		if COLS < MAXWIDTH {
-			COLS = MAXWIDTH
-		}
+		updateScreenSize()
 		TERMINAL.Clear()
 		DisplayBuffer()
+		if VIM.Enabled {
+			displayVimSelection()
+			ShowCursor()
+		}
 		DisplayStatus()
 		TERMINAL.Show()
-		inputHandling()
+		if VIM.Enabled {
+			VimInput()
+		} else {
+			inputHandling()
+		}
+		UpdateSwapFiles()
 		//TERMINAL.SetCursor(CURSORX, CURSORY)
 
 	}
 }
 
+// updateScreenSize reads the terminal size and lays out the panes in it.
+// Sets COLS and ROWS to the active pane, the last screen row is left for the status bar
+func updateScreenSize() {
+	SCREENCOLS, SCREENROWS = TERMINAL.Size()
+	if SCREENCOLS < MAXWIDTH+LINECOUNTWIDTH {
+		SCREENCOLS = MAXWIDTH + LINECOUNTWIDTH
+	}
+	LayoutPanes()
+}
+
 func inputHandling() {
 	event := TERMINAL.PollEvent()
 
 	switch ev := event.(type) {
 
 	case *tcell.EventKey:
-		mod, key, ch := ev.Modifiers(), ev.Key(), ev.Rune()
+		STATUSMESSAGE = ""
+		LASTINPUT = time.Now()
+		COMMANDCOMPLETIONS = nil
+		if HandleKeymap(COMMANDKEYS, ev) {
+			return
+		}
+		mod, key := ev.Modifiers(), ev.Key()
+		// The arrows move the text cursor while no command is typed, and edit the command once one is
+		typing := len(INPUTBUFFER.Text) > 0 || INPUTBUFFER.Browsing()
 		if mod == tcell.ModNone {
-			switch key {
-			case tcell.KeyEnter:
+			switch {
+			case key == tcell.KeyEnter:
 				{
+					AddPromptHistory("command", strings.TrimSpace(INPUTBUFFER.String()))
 					handleCommand()
-					INPUTBUFFER = []rune{}
+					INPUTBUFFER = NewPromptInput("command")
 				}
-			case tcell.KeyBackspace, tcell.KeyBackspace2:
+			case key == tcell.KeyEsc:
 				{
-					if len(INPUTBUFFER) > 0 {
-						INPUTBUFFER = INPUTBUFFER[:len(INPUTBUFFER)-1]
-					}
+					INPUTBUFFER.Reset()
 				}
-			case tcell.KeyEsc:
+			case key == tcell.KeyTab:
 				{
-					return
+					completeCommandLine()
 				}
-			case tcell.KeyUp:
+			case key == tcell.KeyUp && typing:
+				INPUTBUFFER.HistoryPrev()
+			case key == tcell.KeyDown && typing:
+				INPUTBUFFER.HistoryNext()
+			case (key == tcell.KeyLeft || key == tcell.KeyRight) && typing:
+				INPUTBUFFER.HandleKey(ev)
+			case key == tcell.KeyUp:
 				{
 					if CURSORY > 0 {
 						// Move cursor up within visible area
@@ -135,7 +330,7 @@ func inputHandling() {
 						CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
 					}
 				}
-			case tcell.KeyDown:
+			case key == tcell.KeyDown:
 				{
 					if CURSORY < ROWS-1 && CURSORY+OFFSETY+1 < len(TEXTBUFFER) {
 						// Move cursor down within visible area
@@ -149,7 +344,7 @@ func inputHandling() {
 						CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
 					}
 				}
-			case tcell.KeyLeft:
+			case key == tcell.KeyLeft:
 				{
 					if CURSORX > LINECOUNTWIDTH {
 						CURSORX--
@@ -161,7 +356,7 @@ func inputHandling() {
 						OFFSETX--
 					}
 				}
-			case tcell.KeyRight:
+			case key == tcell.KeyRight:
 				{
 					if CURSORY+OFFSETY < len(TEXTBUFFER) {
 						// Only allow moving right if not past end of line
@@ -177,43 +372,51 @@ func inputHandling() {
 					}
 				}
 			default:
-				INPUTBUFFER = append(INPUTBUFFER, ch)
+				INPUTBUFFER.HandleKey(ev)
 			}
 		} else if mod == tcell.ModCtrl {
-
-		} else if mod == tcell.ModAlt {
+			switch key {
+			case tcell.KeyCtrlP:
+				INPUTBUFFER.HistoryPrev()
+			case tcell.KeyCtrlN:
+				INPUTBUFFER.HistoryNext()
+			default:
+				INPUTBUFFER.HandleKey(ev)
+			}
 		}
-
+	case *EventTick:
+		handleTick()
+	case *tcell.EventFocus:
+		handleFocus(ev)
 	}
 }
 
+// completeCommandLine completes the command name or file argument before the cursor in the status bar
+func completeCommandLine() {
+	before := string(INPUTBUFFER.Text[:INPUTBUFFER.Cursor])
+	after := string(INPUTBUFFER.Text[INPUTBUFFER.Cursor:])
+	completed, candidates := CompleteCommand(before)
+	INPUTBUFFER.Set(completed + after)
+	INPUTBUFFER.Cursor = len([]rune(completed))
+	COMMANDCOMPLETIONS = candidates
+}
+
+// handleCommand runs the commands in INPUTBUFFER, separated by ";" and with aliases expanded,
+// showing mistakes in the status bar
 func handleCommand() {
-	switch strings.ToLower(string(INPUTBUFFER)) {
-	case "quit", "q":
-		TERMINAL.Clear()
-		TERMINAL.Show()
-		os.Exit(0)
-	case "write", "w":
-		WriteLoop()
-	case "open", "o":
-		OpenLoop()
-		CURSORX = LINECOUNTWIDTH
-		CURSORY = 0
-	case "save", "s":
-		saveCurrentState()
-	case "saveas", "sa":
-		SOURCEFILE = SaveAsLoop()
-	case "visual", "vs":
-		ChangeSettingsLoop()
-	case "update":
-		UpdateFromGIT()
-	case "clear", "c":
-		TEXTBUFFER = [][]rune{{}}
-		OFFSETX = 0
-		OFFSETY = 0
-		CURSORX = LINECOUNTWIDTH
-		CURSORY = 0
-		TERMINAL.ShowCursor(CURSORX, CURSORY)
+	commands, err := ExpandAliases(INPUTBUFFER.String())
+	if err != nil {
+		STATUSMESSAGE = err.Error()
+	}
+	for _, command := range commands {
+		name, args, err := ParseCommand(command)
+		if err != nil {
+			STATUSMESSAGE = err.Error()
+			break
+		}
+		if name != "" {
+			executeCommand(name, args)
+		}
 	}
 	TERMINAL.Clear()
 	DisplayBuffer()
@@ -233,3 +436,52 @@ func saveCurrentState() {
 		SOURCEFILE = newSourceFile
 	}
 }
+
+// confirmQuit asks about unsaved changes in every open buffer, switching to each one in turn.
+// Returns true if it is safe to quit
+func confirmQuit() bool {
+	storeActiveBuffer()
+	for i, buffer := range BUFFERS {
+		// The filter buffer isn't lost on quit, it goes to stdout
+		if !buffer.Modified || buffer == FILTERBUFFER {
+			continue
+		}
+		SwitchBuffer(i)
+		if !confirmDiscardChanges() {
+			return false
+		}
+	}
+	return true
+}
+
+// confirmDiscardChanges asks what to do with unsaved changes before TEXTBUFFER is thrown away.
+// Returns true if it is safe to continue, either because the buffer was saved or the changes were discarded
+func confirmDiscardChanges() bool {
+	if !MODIFIED {
+		return true
+	}
+	storeActiveBuffer()
+	message := "Unsaved changes in " + BufferName(BUFFERS[CURRENTBUFFER]) + "!"
+	switch ChoiceLoop(message, []string{"save", "discard", "cancel"}) {
+	case 0:
+		saveCurrentState()
+		// Saving may fail or be cancelled in the save-as prompt
+		return !MODIFIED
+	case 1:
+		return true
+	default:
+		return false
+	}
+}
+
+// setLineEnding converts the active buffer to a line ending, taking effect on the next save
+func setLineEnding(lineEnding string) {
+	if refuseReadOnly() {
+		return
+	}
+	if FILEFORMAT.LineEnding == lineEnding {
+		return
+	}
+	FILEFORMAT.LineEnding = lineEnding
+	markChanged()
+}
@@ -1,49 +1,252 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
 )
 
+// PREVIEWLINES is how much of the highlighted file the finder previews, PREVIEWMINWIDTH the narrowest screen that has a preview
+const PREVIEWLINES = 200
+const PREVIEWMINWIDTH = 60
+
+// PREVIEWBYTES caps how much of a file the preview reads, so a huge single line can't be loaded whole
+const PREVIEWBYTES = 64 * 1024
+
+// OpenLoop is the file finder. It lists the files below the working directory as they are found,
+// ranks them against what is typed with FuzzyRank and previews the highlighted one.
+// Enter opens the highlighted file. Going up past the first match selects the prompt, where Enter opens
+// the typed path, Up/Down go through earlier paths and Tab completes it
 func OpenLoop() {
-	var openBuffer []rune
+	input := NewPromptInput("path")
+	walk := StartFileWalk(".")
+	defer walk.Cancel()
+
+	// selected is an index into matches, -1 for the prompt
+	selected, scroll := 0, 0
+	var matches []FuzzyResult
+	var completions []string
+	rankedPattern, rankedCount := "", -1
+	previewPath, preview := "", []string(nil)
 
 	for {
+		files, done := walk.Files()
+		pattern := input.String()
+		if pattern != rankedPattern || len(files) != rankedCount {
+			matches = FuzzyRank(pattern, files)
+			rankedPattern, rankedCount = pattern, len(files)
+		}
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < -1 {
+			selected = -1
+		}
+		highlighted := selected >= 0
+
+		width, height := TERMINAL.Size()
+		// The prompt and the match count take the first two rows
+		listRows := height - 2
+		if selected >= 0 && selected < scroll {
+			scroll = selected
+		}
+		if selected >= scroll+listRows {
+			scroll = selected - listRows + 1
+		}
+		if scroll < 0 {
+			scroll = 0
+		}
+
+		if !highlighted {
+			previewPath, preview = "", nil
+		} else if matches[selected].Text != previewPath {
+			previewPath = matches[selected].Text
+			preview = previewFile(previewPath, PREVIEWLINES)
+		}
+
 		TERMINAL.Clear()
-		DisplayBuffer()
-		DisplayStatus()
-		PrintMessageStyle((COLS/2)-LINECOUNTWIDTH, (ROWS / 2), STYLES.MSGSTYLE, "Open File:")
-		PrintMessageStyle((COLS/2)-LINECOUNTWIDTH, (ROWS/2)+1, STYLES.MSGSTYLE, string(openBuffer))
+		displayFinder(width, height, input, selected, scroll, matches, completions, len(files), done, preview)
 		TERMINAL.Show()
 
 		event := TERMINAL.PollEvent()
 
 		switch ev := event.(type) {
 		case *tcell.EventKey:
-			if ev.Key() == tcell.KeyEnter {
-				filename := string(openBuffer)
+			switch ev.Key() {
+			case tcell.KeyEnter:
+				filename := ExpandPath(pattern)
+				if highlighted {
+					filename = matches[selected].Text
+				}
 				if filename != "" {
-					newTEXTBUFFER, err := OpenFile(filename)
-					if err != nil {
-						// Show error but continue with current buffer
-						PrintMessage(0, ROWS, tcell.ColorRed, tcell.ColorDefault, "Error opening file")
-						TERMINAL.Show()
-						TERMINAL.PollEvent()
-						return
-					}
-					TEXTBUFFER = newTEXTBUFFER
-					SOURCEFILE = filename
+					AddPromptHistory("path", filename)
+					openFileByName(filename)
 					return
 				}
-				break
-			} else if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
-				if len(openBuffer) > 0 {
-					openBuffer = openBuffer[:len(openBuffer)-1]
+			case tcell.KeyUp:
+				if selected >= 0 {
+					selected--
+				} else {
+					input.HistoryPrev()
+				}
+			case tcell.KeyDown:
+				if selected >= 0 || !input.HistoryNext() {
+					selected++
 				}
-			} else if ev.Key() == tcell.KeyEscape {
+			case tcell.KeyPgUp:
+				selected -= listRows
+			case tcell.KeyPgDn:
+				selected += listRows
+			case tcell.KeyTab:
+				completed, candidates := CompletePath(pattern)
+				input.Set(completed)
+				completions = candidates
+				selected = -1
+			case tcell.KeyEscape:
+				return
+			default:
+				if input.HandleKey(ev) && input.String() != pattern {
+					selected, scroll = 0, 0
+					completions = nil
+				}
+			}
+		}
+	}
+}
+
+// openFileByName opens a file in a new buffer, switching to it instead if it is already open.
+// Directories open in a browser buffer
+func openFileByName(filename string) {
+	if isDirectory(filename) {
+		if err := OpenDirectory(filename); err != nil {
+			STATUSMESSAGE = fmt.Sprintf("Couldnt open the directory: %s", err.Error())
+			return
+		}
+		DirectoryLoop()
+		return
+	}
+	if index := FindBuffer(filename); index >= 0 {
+		SwitchBuffer(index)
+		return
+	}
+	newTEXTBUFFER, format, err := OpenFile(filename)
+	if err != nil {
+		// Show error but continue with current buffer
+		PrintMessage(0, SCREENROWS-2, tcell.ColorRed, tcell.ColorDefault,
+			fmt.Sprintf("Error opening file: %s", err.Error()))
+		TERMINAL.Show()
+		WaitForKey()
+		return
+	}
+	AddBuffer(newTEXTBUFFER, format, filename)
+}
+
+// displayFinder draws the file finder full screen: the prompt, the ranked matches and the preview beside them.
+// Candidates from Tab completion replace the match count while there are any
+func displayFinder(width, height int, input *PromptInput, selected, scroll int, matches []FuzzyResult, completions []string, fileCount int, done bool, preview []string) {
+	for col := 0; col < width; col++ {
+		TERMINAL.SetContent(col, 0, ' ', nil, STYLES.STATUSSTYLE)
+	}
+	PrintMessageStyle(1, 0, STYLES.STATUSSTYLE, "Open File: ")
+	// The prompt is drawn like the highlighted match while it is selected
+	inputStyle := STYLES.STATUSSTYLE
+	if selected < 0 {
+		inputStyle = STYLES.MAINSTYLE
+	}
+	displayPromptInput(12, 0, inputStyle, input)
+
+	info := fmt.Sprintf("%d/%d files", len(matches), fileCount)
+	if !done {
+		info += ", searching..."
+	}
+	if len(completions) > 0 {
+		info = strings.Join(completions, "  ")
+	}
+	printClipped(1, 1, width, STYLES.LINECOUNTSTYLE, " "+info+" ")
+
+	listWidth := width
+	if width >= PREVIEWMINWIDTH {
+		listWidth = width / 2
+		for row := 1; row < height; row++ {
+			TERMINAL.SetContent(listWidth, row, '│', nil, STYLES.LINECOUNTSTYLE)
+		}
+		for row, line := range preview {
+			if row+2 >= height {
 				break
-			} else if ev.Rune() != 0 {
-				openBuffer = append(openBuffer, ev.Rune())
 			}
+			printClipped(listWidth+2, row+2, width, STYLES.MAINSTYLE, line)
+		}
+	}
+
+	for row := 0; row+2 < height && scroll+row < len(matches); row++ {
+		match := matches[scroll+row]
+		style := STYLES.MAINSTYLE
+		if scroll+row == selected {
+			style = style.Reverse(true)
+			for col := 0; col < listWidth; col++ {
+				TERMINAL.SetContent(col, row+2, ' ', nil, style)
+			}
+		}
+		// Matched characters are underlined, so it is clear why a file is listed
+		matched := make(map[int]bool, len(match.Positions))
+		for _, position := range match.Positions {
+			matched[position] = true
+		}
+		col := 1
+		for i, char := range []rune(match.Text) {
+			charWidth := runewidth.RuneWidth(char)
+			if col+charWidth > listWidth-1 {
+				break
+			}
+			TERMINAL.SetContent(col, row+2, char, nil, style.Underline(matched[i]).Bold(matched[i]))
+			col += charWidth
+		}
+	}
+}
+
+// printClipped prints a message that is cut off at maxCol
+func printClipped(col, row, maxCol int, style tcell.Style, msg string) {
+	for _, char := range msg {
+		charWidth := runewidth.RuneWidth(char)
+		if col+charWidth > maxCol {
+			return
+		}
+		TERMINAL.SetContent(col, row, char, nil, style)
+		col += charWidth
+	}
+}
+
+// previewFile reads the first lines of a file for the finder's preview. Binary files aren't shown
+func previewFile(filename string, maxLines int) []string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer file.Close()
+
+	var lines []string
+	// Read like ReadBuffer, so long lines don't end the preview early
+	reader := bufio.NewReader(io.LimitReader(file, PREVIEWBYTES))
+	for len(lines) < maxLines {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if strings.ContainsRune(line, 0) {
+				return []string{"(binary file)"}
+			}
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			lines = append(lines, strings.ReplaceAll(line, "\t", "    "))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return append(lines, fmt.Sprintf("failed to read file: %s", err.Error()))
 		}
 	}
+	return lines
 }
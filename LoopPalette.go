@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// PALETTEWIDTH is the widest the palette gets, it is narrower on small screens
+const PALETTEWIDTH = 80
+
+// paletteEntry is a command or an alias listed in the palette
+type paletteEntry struct {
+	Name        string
+	Usage       string
+	Description string
+	Key         string
+}
+
+// paletteEntries lists the registered commands, then the aliases by name
+func paletteEntries() []paletteEntry {
+	var entries []paletteEntry
+	for _, command := range COMMANDS {
+		entries = append(entries, paletteEntry{Name: command.Name, Usage: command.Usage, Description: command.Description, Key: KeysFor(command.Name)})
+	}
+	var aliases []string
+	for name := range ALIASES {
+		if FindCommand(name) == nil {
+			aliases = append(aliases, name)
+		}
+	}
+	sort.Strings(aliases)
+	for _, name := range aliases {
+		entries = append(entries, paletteEntry{Name: name, Description: "= " + ALIASES[name], Key: KeysFor(name)})
+	}
+	return entries
+}
+
+// PaletteLoop lists every command and alias with its description and key, filtered fuzzily by what is typed.
+// Up/Down pick one, Enter runs it and Esc goes back without running anything
+func PaletteLoop() {
+	entries := paletteEntries()
+	// Entries are matched on their name and description together
+	byText := map[string]paletteEntry{}
+	var texts []string
+	for _, entry := range entries {
+		text := entry.Name + " " + entry.Description
+		byText[text] = entry
+		texts = append(texts, text)
+	}
+
+	input := &PromptInput{}
+	matches := FuzzyRank("", texts)
+	selected, scroll := 0, 0
+
+	for {
+		width := PALETTEWIDTH
+		if width > SCREENCOLS-4 {
+			width = SCREENCOLS - 4
+		}
+		left := (SCREENCOLS - width) / 2
+		visibleRows := SCREENROWS/2 - 2
+		if visibleRows < 1 {
+			visibleRows = 1
+		}
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		if selected < scroll {
+			scroll = selected
+		}
+		if selected >= scroll+visibleRows {
+			scroll = selected - visibleRows + 1
+		}
+
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		fillRow(left, 1, width, STYLES.STATUSSTYLE)
+		PrintMessageStyle(left+1, 1, STYLES.STATUSSTYLE, "Command:")
+		displayPromptInput(left+10, 1, STYLES.STATUSSTYLE, input)
+		info := fmt.Sprintf("%d/%d", len(matches), len(entries))
+		PrintMessageStyle(left+width-len(info)-1, 1, STYLES.STATUSSTYLE, info)
+		for row := 0; row < visibleRows && scroll+row < len(matches); row++ {
+			style := STYLES.MSGSTYLE
+			if scroll+row == selected {
+				style = style.Reverse(true)
+			}
+			displayPaletteEntry(left, 2+row, width, style, byText[matches[scroll+row].Text], matches[scroll+row].Positions)
+		}
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyUp:
+				selected--
+			case tcell.KeyDown:
+				selected++
+			case tcell.KeyPgUp:
+				selected -= visibleRows
+			case tcell.KeyPgDn:
+				selected += visibleRows
+			case tcell.KeyEnter:
+				if len(matches) == 0 {
+					continue
+				}
+				name := byText[matches[selected].Text].Name
+				AddPromptHistory("command", name)
+				runCommand(name)
+				return
+			case tcell.KeyEscape:
+				return
+			default:
+				if input.HandleKey(ev) {
+					matches = FuzzyRank(input.String(), texts)
+					selected, scroll = 0, 0
+				}
+			}
+		}
+	}
+}
+
+// fillRow paints a row of the palette in a style
+func fillRow(left, row, width int, style tcell.Style) {
+	for col := left; col < left+width; col++ {
+		TERMINAL.SetContent(col, row, ' ', nil, style)
+	}
+}
+
+// displayPaletteEntry draws one line of the palette: the name and usage, the description and the key at the right.
+// positions are the matched runes of "name description", which are underlined
+func displayPaletteEntry(left, row, width int, style tcell.Style, entry paletteEntry, positions []int) {
+	fillRow(left, row, width, style)
+	matched := map[int]bool{}
+	for _, position := range positions {
+		matched[position] = true
+	}
+	right := left + width - 1
+	if entry.Key != "" {
+		right -= runewidth.StringWidth(entry.Key) + 1
+		PrintMessageStyle(right+1, row, style.Bold(true), entry.Key)
+	}
+
+	// drawMatched prints text whose first rune is at index in the matched text
+	drawMatched := func(col int, text string, index int, textStyle tcell.Style) int {
+		for _, char := range text {
+			charWidth := runewidth.RuneWidth(char)
+			if col+charWidth > right {
+				break
+			}
+			charStyle := textStyle
+			if matched[index] {
+				charStyle = charStyle.Underline(true)
+			}
+			TERMINAL.SetContent(col, row, char, nil, charStyle)
+			col += charWidth
+			index++
+		}
+		return col
+	}
+	col := drawMatched(left+1, entry.Name, 0, style.Bold(true))
+	if entry.Usage != "" {
+		printClipped(col+1, row, right, style, entry.Usage)
+	}
+	descriptionCol := left + 26
+	if descriptionCol < col+runewidth.StringWidth(entry.Usage)+2 {
+		descriptionCol = col + runewidth.StringWidth(entry.Usage) + 2
+	}
+	drawMatched(descriptionCol, entry.Description, len([]rune(entry.Name))+1, style)
+}
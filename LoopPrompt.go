@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+)
+
+// TextPromptLoop asks for a line of text, starting out as initial.
+// Returns the text and true on Enter, or false if Esc was pressed
+func TextPromptLoop(title, initial string) (string, bool) {
+	input := &PromptInput{}
+	input.Set(initial)
+
+	for {
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS / 2), STYLES.MSGSTYLE, title)
+		displayPromptInput((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+1, STYLES.MSGSTYLE, input)
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyEnter:
+				return input.String(), true
+			case tcell.KeyEscape:
+				return "", false
+			default:
+				input.HandleKey(ev)
+			}
+		}
+	}
+}
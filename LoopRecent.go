@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// RecentLoop lists the recently used files, most recent first. Enter opens the highlighted one
+// where it was left, Esc goes back
+func RecentLoop() {
+	files := LoadRecent().Files
+	if len(files) == 0 {
+		STATUSMESSAGE = "No recent files"
+		return
+	}
+	selected, scroll := 0, 0
+
+	for {
+		// The list takes the lower half of the screen, above the status bar
+		visibleRows := SCREENROWS - 1 - (SCREENROWS / 2)
+		if visibleRows < 1 {
+			visibleRows = 1
+		}
+		if selected < scroll {
+			scroll = selected
+		}
+		if selected >= scroll+visibleRows {
+			scroll = selected - visibleRows + 1
+		}
+
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)-1, STYLES.MSGSTYLE, "Recent files:")
+		for row := 0; row < visibleRows && scroll+row < len(files); row++ {
+			recent := files[scroll+row]
+			line := fmt.Sprintf(" %s:%d ", recentName(recent.Path), recent.Line+1)
+			style := STYLES.MSGSTYLE
+			if scroll+row == selected {
+				style = style.Reverse(true)
+			}
+			PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+row, style, line)
+		}
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyUp:
+				if selected > 0 {
+					selected--
+				}
+			case tcell.KeyDown:
+				if selected < len(files)-1 {
+					selected++
+				}
+			case tcell.KeyEnter:
+				openFileByName(files[selected].Path)
+				return
+			case tcell.KeyEscape:
+				return
+			}
+		}
+	}
+}
+
+// recentName shortens a recent file's path to be relative to the working directory, when it is inside it
+func recentName(path string) string {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// RecoverLoop goes through the swap files left behind by STE instances that didn't exit cleanly,
+// and asks whether to recover, diff or delete each one. Kept swap files are offered again next time
+func RecoverLoop() {
+	swaps, err := ListSwapFiles()
+	if err != nil {
+		STATUSMESSAGE = fmt.Sprintf("Couldnt look for swap files: %s", err.Error())
+		return
+	}
+
+	for _, swap := range swaps {
+		name := swap.SourceFile
+		if name == "" {
+			name = "[No Name]"
+		}
+		message := fmt.Sprintf("Swap file found for %s, saved %s", name, swap.Saved.Format("2006-01-02 15:04"))
+
+		for {
+			choice := ChoiceLoop(message, []string{"recover", "diff", "delete", "keep"})
+			if choice == 1 {
+				DiffLoop("Changes in swap file for "+name, DiffLines(diskLines(swap.SourceFile), swap.Lines))
+				continue
+			}
+			if choice == 0 {
+				recoverSwap(swap)
+			} else if choice == 2 {
+				os.Remove(swap.Path)
+			}
+			break
+		}
+	}
+}
+
+// recoverSwap loads a swap file's text as a modified buffer for its file
+func recoverSwap(swap SwapFile) {
+	textBuffer := make([][]rune, len(swap.Lines))
+	for i, line := range swap.Lines {
+		textBuffer[i] = []rune(line)
+	}
+	if len(textBuffer) == 0 {
+		textBuffer = [][]rune{{}}
+	}
+
+	index := -1
+	if swap.SourceFile != "" {
+		index = FindBuffer(swap.SourceFile)
+	}
+	if index >= 0 {
+		SwitchBuffer(index)
+		TEXTBUFFER = textBuffer
+		FILEFORMAT = swap.Format
+		HISTORY.Reset()
+		MoveCursorTo(0, 0)
+	} else if !AddBuffer(textBuffer, swap.Format, swap.SourceFile) {
+		return
+	}
+	MODIFIED = true
+	storeActiveBuffer()
+
+	// The old swap file is replaced by the buffer's own, which is written on the next update
+	os.Remove(swap.Path)
+	BUFFERS[CURRENTBUFFER].swapChanges = -1
+}
+
+// diskLines returns the lines of a file as it is on disk, or none if it can't be read
+func diskLines(filename string) []string {
+	if filename == "" {
+		return nil
+	}
+	textBuffer, _, err := OpenFile(filename)
+	if err != nil {
+		return nil
+	}
+	lines := make([]string, len(textBuffer))
+	for i, line := range textBuffer {
+		lines[i] = string(line)
+	}
+	return lines
+}
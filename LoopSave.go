@@ -6,15 +6,24 @@ import (
 	"github.com/gdamore/tcell/v2"
 )
 
+// SaveAsLoop asks for a file name and saves the active buffer to it, returning the name the buffer now has.
+// The prompt has Tab completion and the same history of paths as OpenLoop
 func SaveAsLoop() string {
-	var saveBuffer []rune
+	input := NewPromptInput("path")
+	var completions []string
 
 	for {
 		TERMINAL.Clear()
 		DisplayBuffer()
 		DisplayStatus()
-		PrintMessageStyle((COLS/2)-LINECOUNTWIDTH, (ROWS / 2), STYLES.MSGSTYLE, "Save As:")
-		PrintMessageStyle((COLS/2)-LINECOUNTWIDTH, (ROWS/2)+1, STYLES.MSGSTYLE, string(saveBuffer))
+		PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS / 2), STYLES.MSGSTYLE, "Save As:")
+		displayPromptInput((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+1, STYLES.MSGSTYLE, input)
+		for i, candidate := range completions {
+			if (SCREENROWS/2)+2+i >= SCREENROWS-1 {
+				break
+			}
+			PrintMessageStyle((SCREENCOLS/2)-LINECOUNTWIDTH, (SCREENROWS/2)+2+i, STYLES.LINECOUNTSTYLE, candidate)
+		}
 		TERMINAL.Show()
 
 		event := TERMINAL.PollEvent()
@@ -22,28 +31,41 @@ func SaveAsLoop() string {
 		switch ev := event.(type) {
 		case *tcell.EventKey:
 			if ev.Key() == tcell.KeyEnter {
-				filename := string(saveBuffer)
+				filename := ExpandPath(input.String())
 				if filename != "" {
-					err := WriteBufferToFile(TEXTBUFFER, filename)
-					if err != nil {
-						PrintMessage(0, ROWS, tcell.ColorRed, tcell.ColorDefault,
+					if err := saveBufferAs(filename); err != nil {
+						PrintMessage(0, SCREENROWS-2, tcell.ColorRed, tcell.ColorDefault,
 							fmt.Sprintf("Error saving file: %s", err.Error()))
 						TERMINAL.Show()
-						TERMINAL.PollEvent()
+						WaitForKey()
 					} else {
 						return filename
 					}
 				}
 				return SOURCEFILE
-			} else if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
-				if len(saveBuffer) > 0 {
-					saveBuffer = saveBuffer[:len(saveBuffer)-1]
-				}
+			} else if ev.Key() == tcell.KeyTab {
+				completed, candidates := CompletePath(input.String())
+				input.Set(completed)
+				completions = candidates
+			} else if ev.Key() == tcell.KeyUp {
+				input.HistoryPrev()
+			} else if ev.Key() == tcell.KeyDown {
+				input.HistoryNext()
 			} else if ev.Key() == tcell.KeyEscape {
 				return SOURCEFILE
-			} else if ev.Rune() != 0 {
-				saveBuffer = append(saveBuffer, ev.Rune())
+			} else if input.HandleKey(ev) {
+				completions = nil
 			}
 		}
 	}
 }
+
+// saveBufferAs writes the active buffer to filename and moves its lock there. The caller sets SOURCEFILE
+func saveBufferAs(filename string) error {
+	if err := WriteBufferToFile(TEXTBUFFER, FILEFORMAT, filename); err != nil {
+		return err
+	}
+	AddPromptHistory("path", filename)
+	relockBuffer(BUFFERS[CURRENTBUFFER], filename)
+	return nil
+}
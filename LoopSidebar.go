@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// SidebarLoop gives the sidebar keyboard focus, showing it if it was hidden. Up/Down pick a row,
+// Enter or Right expands a directory, Left collapses it or goes to its parent, and Enter on a file
+// opens it like OpenLoop does. Esc or Ctrl-T gives focus back to the panes
+func SidebarLoop() {
+	if !SIDEBAR.Visible {
+		ToggleSidebar()
+	} else {
+		SIDEBAR.Refresh()
+	}
+	SIDEBAR.Focused = true
+	defer func() { SIDEBAR.Focused = false }()
+	selectCurrentFile()
+
+	for {
+		rows := SIDEBAR.Rows()
+		visibleRows := SCREENROWS - 1
+		if SIDEBAR.Selected >= len(rows) {
+			SIDEBAR.Selected = len(rows) - 1
+		}
+		if SIDEBAR.Selected < 0 {
+			SIDEBAR.Selected = 0
+		}
+		if SIDEBAR.Selected < SIDEBAR.Scroll {
+			SIDEBAR.Scroll = SIDEBAR.Selected
+		}
+		if SIDEBAR.Selected >= SIDEBAR.Scroll+visibleRows {
+			SIDEBAR.Scroll = SIDEBAR.Selected - visibleRows + 1
+		}
+
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			STATUSMESSAGE = ""
+			if ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlT {
+				return
+			}
+			if len(rows) == 0 {
+				continue
+			}
+			row := rows[SIDEBAR.Selected]
+
+			switch ev.Key() {
+			case tcell.KeyUp:
+				SIDEBAR.Selected--
+			case tcell.KeyDown:
+				SIDEBAR.Selected++
+			case tcell.KeyPgUp:
+				SIDEBAR.Selected -= visibleRows
+			case tcell.KeyPgDn:
+				SIDEBAR.Selected += visibleRows
+			case tcell.KeyHome:
+				SIDEBAR.Selected = 0
+			case tcell.KeyEnd:
+				SIDEBAR.Selected = len(rows) - 1
+			case tcell.KeyRight:
+				if row.IsDir {
+					SIDEBAR.SetExpanded(row.Path, true)
+				}
+			case tcell.KeyLeft:
+				if row.IsDir && SIDEBAR.expanded[row.Path] {
+					SIDEBAR.SetExpanded(row.Path, false)
+				} else {
+					selectTreeRow(rows, filepath.Dir(row.Path))
+				}
+			case tcell.KeyEnter:
+				if row.IsDir {
+					SIDEBAR.SetExpanded(row.Path, !SIDEBAR.expanded[row.Path])
+				} else {
+					AddPromptHistory("path", row.Path)
+					openFileByName(row.Path)
+					return
+				}
+			}
+		case *EventTick:
+			continue
+		}
+	}
+}
+
+// selectCurrentFile picks the active buffer's file in the tree, when its directory is expanded
+func selectCurrentFile() {
+	if SOURCEFILE == "" {
+		return
+	}
+	if path, err := filepath.Abs(SOURCEFILE); err == nil {
+		selectTreeRow(SIDEBAR.Rows(), path)
+	}
+}
+
+// selectTreeRow picks the row showing path, if there is one
+func selectTreeRow(rows []TreeRow, path string) {
+	for i, row := range rows {
+		if row.Path == path {
+			SIDEBAR.Selected = i
+			return
+		}
+	}
+}
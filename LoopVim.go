@@ -0,0 +1,621 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// VIMEXCOMMANDS translates the ex command names of vim that STE calls something else.
+// Aliases from config.json or the alias command with the same name win
+var VIMEXCOMMANDS = map[string]string{
+	"w": "save",
+	"x": "save; quit",
+	"e": "open",
+}
+
+// SetVimKeys turns the vim keymap preset on or off, starting in normal mode
+func SetVimKeys(enabled bool) {
+	VIM.Enabled = enabled
+	VIM.Mode = VIMNORMAL
+	VIM.Pending = nil
+}
+
+// VimInput reads one event in vim normal or visual mode. mainEditorLoop calls it instead of inputHandling
+// while the vim keymap preset is on
+func VimInput() {
+	event := TERMINAL.PollEvent()
+
+	switch ev := event.(type) {
+	case *tcell.EventKey:
+		STATUSMESSAGE = ""
+		LASTINPUT = time.Now()
+		COMMANDCOMPLETIONS = nil
+		// Bindings like Ctrl-T still work, but not in the middle of a vim command.
+		// A binding that moves to another buffer leaves visual mode, whose anchor was in the old one
+		buffer := BUFFERS[CURRENTBUFFER]
+		if len(VIM.Pending) == 0 && HandleKeymap(COMMANDKEYS, ev) {
+			if BUFFERS[CURRENTBUFFER] != buffer {
+				VIM.Mode = VIMNORMAL
+				VIM.Pending = nil
+			}
+			return
+		}
+		handleVimKey(vimKeyName(ev))
+	case *EventTick:
+		handleTick()
+	case *tcell.EventFocus:
+		handleFocus(ev)
+	}
+}
+
+// vimKeyName writes a key press as a vim command key: typed characters as they are, other keys as KeyName writes them
+func vimKeyName(ev *tcell.EventKey) string {
+	if ev.Key() == tcell.KeyRune && ev.Modifiers()&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+		return string(ev.Rune())
+	}
+	name := KeyName(ev)
+	if name == "Backspace" || name == "Backspace2" {
+		return "h"
+	}
+	return name
+}
+
+// handleVimKey adds a key to the command being typed in normal or visual mode, running it once it is complete
+func handleVimKey(key string) {
+	vimClampCursor()
+	if key == "Esc" {
+		if len(VIM.Pending) == 0 && VIM.Mode != VIMNORMAL {
+			VIM.Mode = VIMNORMAL
+		}
+		VIM.Pending = nil
+		return
+	}
+	if key == "Enter" && len(VIM.Pending) == 0 && BUFFERS[CURRENTBUFFER].Directory != "" {
+		DirectoryLoop()
+		return
+	}
+
+	VIM.Pending = append(VIM.Pending, key)
+	visual := VIM.Mode == VIMVISUAL || VIM.Mode == VIMVISUALLINE
+	cmd, complete, ok := parseVimCommand(VIM.Pending, visual)
+	if !ok {
+		VIM.Pending = nil
+		return
+	}
+	if !complete {
+		return
+	}
+	VIM.Pending = nil
+	if visual {
+		runVimVisual(cmd)
+	} else {
+		runVimCommand(cmd, false)
+	}
+	vimClampCursor()
+}
+
+// vimClampCursor keeps the cursor on a character in normal and visual mode, where it can't sit past the end of a line
+func vimClampCursor() {
+	pos := CursorPosition()
+	MoveCursorTo(pos.Line, pos.Col)
+	pos = CursorPosition()
+	if pos.Col > vimLastCol(pos.Line) {
+		MoveCursorTo(pos.Line, vimLastCol(pos.Line))
+	}
+}
+
+// vimMove runs a motion in normal or visual mode. j and k keep the column the cursor had before them
+func vimMove(cmd vimCommand) {
+	target, _, _, ok := vimMotion(cmd.Key, cmd.Char, cmd.Count, CursorPosition(), false)
+	if !ok {
+		return
+	}
+	MoveCursorTo(target.Line, target.Col)
+	switch cmd.Key {
+	case "j", "k", "Up", "Down":
+	case "$":
+		VIM.WantCol = -1
+	default:
+		VIM.WantCol = target.Col
+	}
+}
+
+// vimChanges are the normal mode actions that change the buffer, which . repeats
+var vimChanges = map[string]bool{
+	"x": true, "X": true, "s": true, "S": true, "D": true, "C": true, "p": true, "P": true, "J": true, "r": true,
+	"i": true, "a": true, "I": true, "A": true, "o": true, "O": true,
+}
+
+// runVimCommand runs a complete normal mode command. repeating is set when . runs the last change again,
+// which types the keys recorded for it instead of reading new ones in insert mode
+func runVimCommand(cmd vimCommand, repeating bool) {
+	count := maxInt(cmd.Count, 1)
+	if vimChanges[cmd.Key] || cmd.Operator == "d" || cmd.Operator == "c" {
+		if refuseReadOnly() {
+			return
+		}
+		HISTORY.BeginStep()
+		defer HISTORY.EndStep()
+		change := cmd
+		VIM.LastChange = &change
+	}
+	if cmd.Operator != "" {
+		runVimOperator(cmd, repeating)
+		return
+	}
+	if vimMotions[cmd.Key] {
+		vimMove(cmd)
+		return
+	}
+
+	pos := CursorPosition()
+	line := TEXTBUFFER[pos.Line]
+	switch cmd.Key {
+	case "u":
+		for n := 0; n < count && Undo(); n++ {
+		}
+	case "Ctrl-R":
+		for n := 0; n < count && Redo(); n++ {
+		}
+	case ".":
+		if VIM.LastChange == nil {
+			return
+		}
+		repeat := *VIM.LastChange
+		if cmd.Count > 0 {
+			repeat.Count, repeat.MotionCount = cmd.Count, 0
+		}
+		runVimCommand(repeat, true)
+	case "v", "V":
+		VIM.Mode = VIMVISUAL
+		if cmd.Key == "V" {
+			VIM.Mode = VIMVISUALLINE
+		}
+		VIM.Anchor = pos
+	case ":":
+		vimExLoop()
+	case "x":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "d", Key: "l"}, repeating)
+	case "X":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "d", Key: "h"}, repeating)
+	case "s":
+		if len(line) == 0 {
+			vimInsert(1, repeating, false)
+			return
+		}
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "c", Key: "l"}, repeating)
+	case "S":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "c", Key: "c"}, repeating)
+	case "D":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "d", Key: "$"}, repeating)
+	case "C":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "c", Key: "$"}, repeating)
+	case "Y":
+		runVimOperator(vimCommand{Count: cmd.Count, Operator: "y", Key: "y"}, repeating)
+	case "p", "P":
+		vimPut(pos, cmd.Key == "P", count)
+	case "J":
+		vimJoinLines(pos.Line, maxInt(count-1, 1))
+	case "r":
+		if pos.Col+count > len(line) {
+			return
+		}
+		deleteText(pos, BufferPos{pos.Line, pos.Col + count})
+		if cmd.Char == "\n" {
+			end := insertText(pos, "\n")
+			MoveCursorTo(end.Line, end.Col)
+			return
+		}
+		insertText(pos, strings.Repeat(cmd.Char, count))
+		MoveCursorTo(pos.Line, pos.Col+count-1)
+	case "i", "a", "I", "A", "o", "O":
+		switch cmd.Key {
+		case "a":
+			MoveCursorTo(pos.Line, minInt(pos.Col+1, len(line)))
+		case "I":
+			MoveCursorTo(pos.Line, vimFirstNonBlank(pos.Line))
+		case "A":
+			MoveCursorTo(pos.Line, len(line))
+		case "o":
+			insertText(BufferPos{pos.Line, len(line)}, "\n")
+			MoveCursorTo(pos.Line+1, 0)
+		case "O":
+			insertText(BufferPos{pos.Line, 0}, "\n")
+			MoveCursorTo(pos.Line, 0)
+		}
+		vimInsert(count, repeating, cmd.Key == "o" || cmd.Key == "O")
+	}
+}
+
+// runVimOperator runs d, c or y over the text a motion or text object covers. dd, cc and yy work on whole lines
+func runVimOperator(cmd vimCommand, repeating bool) {
+	pos := CursorPosition()
+	count := maxInt(cmd.Count, 1) * maxInt(cmd.MotionCount, 1)
+	from, to := pos, pos
+	linewise := false
+
+	switch {
+	case cmd.Key == cmd.Operator:
+		linewise = true
+		to.Line = minInt(pos.Line+count-1, len(TEXTBUFFER)-1)
+	case len(cmd.Key) == 2 && (cmd.Key[0] == 'i' || cmd.Key[0] == 'a'):
+		start, end, ok := vimTextObject(cmd.Key, pos)
+		if !ok {
+			return
+		}
+		from, to = start, end
+	default:
+		key := cmd.Key
+		// cw changes to the end of the word, like ce, unless the cursor is on a blank
+		if cmd.Operator == "c" && (key == "w" || key == "W") && vimClass(vimChar(pos), false) != 0 {
+			key = map[string]string{"w": "e", "W": "E"}[key]
+		}
+		typed := 0
+		if cmd.Count > 0 || cmd.MotionCount > 0 {
+			typed = count
+		}
+		target, lines, inclusive, ok := vimMotion(key, cmd.Char, typed, pos, true)
+		// On the last character of a word, cw only changes that character
+		if key != cmd.Key && count == 1 && vimClass(vimChar(BufferPos{pos.Line, pos.Col + 1}), key == "E") != vimClass(vimChar(pos), key == "E") {
+			target = pos
+		}
+		if !ok {
+			return
+		}
+		from, to = pos, target
+		if vimBefore(to, from) {
+			from, to = to, from
+		}
+		linewise = lines
+		if inclusive {
+			to, _ = vimNext(to)
+			if to == from {
+				to.Col++
+			}
+		}
+	}
+
+	if linewise {
+		vimOperateLines(cmd.Operator, from.Line, to.Line, pos, repeating)
+		return
+	}
+	VIM.Register = VimRegister{Text: textBetween(from, to)}
+	switch cmd.Operator {
+	case "y":
+		MoveCursorTo(from.Line, from.Col)
+	case "d":
+		deleteText(from, to)
+		MoveCursorTo(from.Line, from.Col)
+	case "c":
+		deleteText(from, to)
+		MoveCursorTo(from.Line, from.Col)
+		vimInsert(1, repeating, false)
+	}
+}
+
+// vimOperateLines runs d, c or y over whole lines
+func vimOperateLines(operator string, first, last int, pos BufferPos, repeating bool) {
+	VIM.Register = VimRegister{Text: linesText(first, last), Linewise: true}
+	switch operator {
+	case "y":
+		if first < pos.Line {
+			MoveCursorTo(first, pos.Col)
+		}
+	case "d":
+		deleteLines(first, last)
+		line := minInt(first, len(TEXTBUFFER)-1)
+		MoveCursorTo(line, vimFirstNonBlank(line))
+	case "c":
+		deleteText(BufferPos{first, 0}, BufferPos{last, len(TEXTBUFFER[last])})
+		MoveCursorTo(first, 0)
+		vimInsert(1, repeating, false)
+	}
+}
+
+// vimPut is p and P: the register is put count times after the cursor, or before it for P.
+// Linewise text goes below or above the cursor line
+func vimPut(pos BufferPos, before bool, count int) {
+	register := VIM.Register
+	if register.Text == "" && !register.Linewise {
+		return
+	}
+	if register.Linewise {
+		text := strings.Repeat(register.Text+"\n", count)
+		line := pos.Line
+		if before {
+			insertText(BufferPos{line, 0}, text)
+		} else {
+			insertText(BufferPos{line, len(TEXTBUFFER[line])}, "\n"+strings.TrimSuffix(text, "\n"))
+			line++
+		}
+		MoveCursorTo(line, vimFirstNonBlank(line))
+		return
+	}
+	at := pos
+	if !before && len(TEXTBUFFER[pos.Line]) > 0 {
+		at.Col++
+	}
+	end := insertText(at, strings.Repeat(register.Text, count))
+	if strings.Contains(register.Text, "\n") {
+		MoveCursorTo(at.Line, at.Col)
+		return
+	}
+	MoveCursorTo(end.Line, end.Col-1)
+}
+
+// vimJoinLines is J: joins lines below onto a line, putting one space where the leading blanks of each line were
+func vimJoinLines(line, joins int) {
+	for n := 0; n < joins && line+1 < len(TEXTBUFFER); n++ {
+		join := len(TEXTBUFFER[line])
+		next := TEXTBUFFER[line+1]
+		blanks := 0
+		for blanks < len(next) && (next[blanks] == ' ' || next[blanks] == '\t') {
+			blanks++
+		}
+		deleteText(BufferPos{line + 1, 0}, BufferPos{line + 1, blanks})
+		deleteText(BufferPos{line, join}, BufferPos{line + 1, 0})
+		if join > 0 && blanks < len(next) && next[blanks] != ')' {
+			insertText(BufferPos{line, join}, " ")
+		}
+		MoveCursorTo(line, join)
+	}
+}
+
+// vimInsert is insert mode: keys edit the buffer like in WriteLoop until Esc, then the text is typed count-1
+// more times, on new lines after o and O. The keys are kept for ., and repeating types them instead of reading new ones
+func vimInsert(count int, repeating bool, newLines bool) {
+	keys := VIM.LastInsert
+	first := 0
+	if !repeating {
+		keys = nil
+		first = 1
+		VIM.Mode = VIMINSERT
+	insert:
+		for {
+			TERMINAL.Clear()
+			DisplayBuffer()
+			DisplayStatus()
+			ShowCursor()
+			TERMINAL.Show()
+
+			event := TERMINAL.PollEvent()
+			switch ev := event.(type) {
+			case *tcell.EventKey:
+				stay, bound := handleWriteKey(ev)
+				if !stay {
+					break insert
+				}
+				// Keys taken by bindings, like undo or a chord, aren't typed again by .
+				if !bound {
+					keys = append(keys, ev)
+				}
+			case *EventTick:
+				handleTick()
+			case *tcell.EventFocus:
+				handleFocus(ev)
+			}
+			UpdateSwapFiles()
+		}
+		VIM.Mode = VIMNORMAL
+	}
+
+	for n := first; n < count; n++ {
+		if newLines && n > 0 {
+			insertEnter()
+		}
+		for _, key := range keys {
+			handleWriteKey(key)
+		}
+	}
+	// A chord left unfinished by the typed keys mustn't swallow the next key in normal mode
+	KEYPENDING = nil
+	VIM.LastInsert = keys
+	// Leaving insert mode puts the cursor on the last character typed
+	pos := CursorPosition()
+	if pos.Col > 0 {
+		MoveCursorTo(pos.Line, pos.Col-1)
+	}
+}
+
+// runVimVisual runs a complete visual mode command. Motions and text objects change the selection,
+// the other commands work on it and go back to normal mode
+func runVimVisual(cmd vimCommand) {
+	if vimMotions[cmd.Key] {
+		vimMove(cmd)
+		return
+	}
+	if len(cmd.Key) == 2 && (cmd.Key[0] == 'i' || cmd.Key[0] == 'a') {
+		start, end, ok := vimTextObject(cmd.Key, CursorPosition())
+		if ok && vimBefore(start, end) {
+			VIM.Anchor = start
+			last, _ := vimPrev(end)
+			MoveCursorTo(last.Line, last.Col)
+		}
+		return
+	}
+
+	pos := CursorPosition()
+	switch cmd.Key {
+	case "v", "V":
+		mode := VIMVISUAL
+		if cmd.Key == "V" {
+			mode = VIMVISUALLINE
+		}
+		if VIM.Mode == mode {
+			VIM.Mode = VIMNORMAL
+		} else {
+			VIM.Mode = mode
+		}
+		return
+	case "o":
+		VIM.Anchor, pos = pos, vimClampPos(VIM.Anchor)
+		MoveCursorTo(pos.Line, pos.Col)
+		return
+	case ":":
+		VIM.Mode = VIMNORMAL
+		vimExLoop()
+		return
+	}
+
+	VIM.Anchor = vimClampPos(VIM.Anchor)
+	from, to := VIM.Anchor, pos
+	if vimBefore(to, from) {
+		from, to = to, from
+	}
+	linewise := VIM.Mode == VIMVISUALLINE || strings.ToUpper(cmd.Key) == cmd.Key
+	VIM.Mode = VIMNORMAL
+	if cmd.Key != "y" && cmd.Key != "Y" {
+		if refuseReadOnly() {
+			return
+		}
+		HISTORY.BeginStep()
+		defer HISTORY.EndStep()
+	}
+
+	operator := "d"
+	switch cmd.Key {
+	case "y", "Y":
+		operator = "y"
+	case "c", "s", "C", "S":
+		operator = "c"
+	case "J":
+		vimJoinLines(from.Line, maxInt(to.Line-from.Line, 1))
+		return
+	}
+	if linewise {
+		vimOperateLines(operator, from.Line, to.Line, from, false)
+		return
+	}
+	// The selection includes the character under its end
+	to, _ = vimNext(to)
+	if to == from {
+		to.Col++
+	}
+	VIM.Register = VimRegister{Text: textBetween(from, to)}
+	if operator != "y" {
+		deleteText(from, to)
+	}
+	MoveCursorTo(from.Line, from.Col)
+	if operator == "c" {
+		vimInsert(1, false, false)
+	}
+}
+
+// displayVimSelection shows the visual mode selection in reverse, in the active pane
+func displayVimSelection() {
+	if VIM.Mode != VIMVISUAL && VIM.Mode != VIMVISUALLINE {
+		return
+	}
+	from, to := vimClampPos(VIM.Anchor), CursorPosition()
+	if vimBefore(to, from) {
+		from, to = to, from
+	}
+	for line := maxInt(from.Line, OFFSETY); line <= to.Line && line < OFFSETY+ROWS && line < len(TEXTBUFFER); line++ {
+		start, end := 0, len(TEXTBUFFER[line])
+		if VIM.Mode == VIMVISUAL {
+			if line == from.Line {
+				start = from.Col
+			}
+			if line == to.Line {
+				end = minInt(to.Col+1, end)
+			}
+		}
+		// Empty lines show one selected cell
+		end = maxInt(end, start+1)
+		for col := start; col < end; col++ {
+			if col-OFFSETX < 0 || col-OFFSETX >= COLS {
+				continue
+			}
+			x := ACTIVEPANE.X + LINECOUNTWIDTH + col - OFFSETX
+			y := ACTIVEPANE.Y + line - OFFSETY
+			char, combining, style, _ := TERMINAL.GetContent(x, y)
+			TERMINAL.SetContent(x, y, char, combining, style.Reverse(true))
+		}
+	}
+}
+
+// vimModeIndicator describes the vim mode for the status bar, with the keys of a command typed so far
+func vimModeIndicator() string {
+	if len(VIM.Pending) > 0 {
+		return fmt.Sprintf("%s %s", VIM.Mode, strings.Join(VIM.Pending, ""))
+	}
+	return VIM.Mode
+}
+
+// vimExLoop reads an ex command after ":" with the editing, history and Tab completion of the command line.
+// Enter runs it through handleCommand, and Esc or Backspace on an empty line goes back to normal mode
+func vimExLoop() {
+	mode := VIM.Mode
+	VIM.Mode = VIMCOMMAND
+	defer func() { VIM.Mode = mode }()
+	INPUTBUFFER = NewPromptInput("command")
+
+	for {
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		TERMINAL.Show()
+
+		event := TERMINAL.PollEvent()
+		switch ev := event.(type) {
+		case *tcell.EventKey:
+			STATUSMESSAGE = ""
+			LASTINPUT = time.Now()
+			COMMANDCOMPLETIONS = nil
+			switch ev.Key() {
+			case tcell.KeyEnter:
+				line := strings.TrimSpace(INPUTBUFFER.String())
+				AddPromptHistory("command", line)
+				INPUTBUFFER.Set(vimExCommand(line))
+				handleCommand()
+				INPUTBUFFER = NewPromptInput("command")
+				return
+			case tcell.KeyEsc:
+				INPUTBUFFER = NewPromptInput("command")
+				return
+			case tcell.KeyBackspace, tcell.KeyBackspace2:
+				if len(INPUTBUFFER.Text) == 0 {
+					return
+				}
+				INPUTBUFFER.HandleKey(ev)
+			case tcell.KeyTab:
+				completeCommandLine()
+			case tcell.KeyUp, tcell.KeyCtrlP:
+				INPUTBUFFER.HistoryPrev()
+			case tcell.KeyDown, tcell.KeyCtrlN:
+				INPUTBUFFER.HistoryNext()
+			default:
+				INPUTBUFFER.HandleKey(ev)
+			}
+		case *EventTick:
+			handleTick()
+		case *tcell.EventFocus:
+			handleFocus(ev)
+		}
+	}
+}
+
+// vimExCommand translates an ex command line for handleCommand. A line number moves the cursor there,
+// and the vim names in VIMEXCOMMANDS become the STE commands
+func vimExCommand(line string) string {
+	if number, err := strconv.Atoi(line); err == nil {
+		target := minInt(maxInt(number, 1), len(TEXTBUFFER)) - 1
+		MoveCursorTo(target, vimFirstNonBlank(target))
+		return ""
+	}
+	commands := SplitCommands(line)
+	for i, command := range commands {
+		name, rest := splitCommandName(command)
+		name = strings.ToLower(name)
+		replacement, ok := VIMEXCOMMANDS[name]
+		alias, aliased := ALIASES[name]
+		if ok && (!aliased || alias == BUILTINALIASES[name]) {
+			commands[i] = replacement + rest
+		}
+	}
+	return strings.Join(commands, ";")
+}
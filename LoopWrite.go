@@ -1,212 +1,53 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gdamore/tcell/v2"
 )
 
 func WriteLoop() {
+	HISTORY.BreakGroup()
 	TERMINAL.Clear()
 	DisplayBuffer()
 	DisplayStatus()
-	TERMINAL.ShowCursor(CURSORX, CURSORY)
+	ShowCursor()
 	TERMINAL.Show()
 	for {
 		event := TERMINAL.PollEvent()
 		switch ev := event.(type) {
 		case *tcell.EventKey:
-			mod, key, ch := ev.Modifiers(), ev.Key(), ev.Rune()
-			if mod == tcell.ModNone {
-				switch key {
-				case tcell.KeyUp:
-					if CURSORY > 0 {
-						// Move cursor up within visible area
-						CURSORY--
-					} else if OFFSETY > 0 {
-						// Scroll up when cursor is at top
-						OFFSETY--
-					}
-					// Adjust cursor X if moving to a shorter line
-					if CURSORY+OFFSETY < len(TEXTBUFFER) && CURSORX-LINECOUNTWIDTH > len(TEXTBUFFER[CURSORY+OFFSETY]) {
-						CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
-					}
-				case tcell.KeyDown:
-					if CURSORY < ROWS-1 && CURSORY+OFFSETY+1 < len(TEXTBUFFER) {
-						// Move cursor down within visible area
-						CURSORY++
-					} else if OFFSETY+ROWS < len(TEXTBUFFER) {
-						// Scroll down when cursor is at bottom
-						OFFSETY++
-					}
-					// Adjust cursor X if moving to a shorter line
-					if CURSORY+OFFSETY < len(TEXTBUFFER) && CURSORX-LINECOUNTWIDTH > len(TEXTBUFFER[CURSORY+OFFSETY]) {
-						CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
-					}
-				case tcell.KeyLeft:
-					if CURSORX > LINECOUNTWIDTH {
-						CURSORX--
-						// Horizontal scroll left if needed
-						if CURSORX < LINECOUNTWIDTH {
-							CURSORX = LINECOUNTWIDTH
-						}
-					} else if OFFSETX > 0 {
-						OFFSETX--
-					}
-				case tcell.KeyRight:
-					if CURSORY+OFFSETY < len(TEXTBUFFER) {
-						// Only allow moving right if not past end of line
-						lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
-						if CURSORX-LINECOUNTWIDTH+OFFSETX < lineLen {
-							CURSORX++
-							// Horizontal scroll right if needed
-							if CURSORX >= COLS+LINECOUNTWIDTH {
-								OFFSETX++
-								CURSORX = COLS + LINECOUNTWIDTH - 1
-							}
-						}
-					}
-				case tcell.KeyBackspace, tcell.KeyBackspace2:
-					// If at the left edge and more to the left, scroll left before deleting
-					if CURSORX == LINECOUNTWIDTH && OFFSETX > 0 {
-						OFFSETX--
-					}
-					deleteAtCursor()
-					// Auto-scroll if cursor goes above visible area
-					if CURSORY < 0 {
-						OFFSETY += CURSORY
-						CURSORY = 0
-					}
-					// After deletion, if no characters are visible in the current row, scroll left
-					visibleRow := CURSORY + OFFSETY
-					if visibleRow >= 0 && visibleRow < len(TEXTBUFFER) {
-						line := TEXTBUFFER[visibleRow]
-						if OFFSETX >= len(line) && OFFSETX > 0 {
-							OFFSETX--
-							CURSORX++
-						}
-					}
-					// Horizontal scroll left if needed after delete
-					if CURSORX < LINECOUNTWIDTH && OFFSETX > 0 {
-						OFFSETX--
-						CURSORX = LINECOUNTWIDTH
-					}
-					// If at left edge and more to the left, scroll to show next char to be deleted
-					if CURSORX == LINECOUNTWIDTH && OFFSETX > 0 {
-						OFFSETX--
-					}
-				case tcell.KeyEnter:
-					insertEnter()
-					// Auto-scroll if cursor goes below visible area
-					if CURSORY >= ROWS {
-						OFFSETY += CURSORY - ROWS + 1
-						CURSORY = ROWS - 1
-					}
-				case tcell.KeyEsc:
-					return
-				default:
-					insertRune(ch)
-					// Ensure cursor is visible after insertion (horizontal scroll)
-					if CURSORX >= COLS+LINECOUNTWIDTH {
-						OFFSETX++
-						CURSORX = COLS + LINECOUNTWIDTH - 1
-					}
-					if CURSORX < LINECOUNTWIDTH {
-						if OFFSETX > 0 {
-							OFFSETX--
-							CURSORX = LINECOUNTWIDTH
-						}
-					}
-					// Clamp cursor to end of line after insert
-					lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
-					if CURSORX-LINECOUNTWIDTH+OFFSETX > lineLen {
-						CURSORX = lineLen - OFFSETX + LINECOUNTWIDTH
-						if CURSORX < LINECOUNTWIDTH {
-							CURSORX = LINECOUNTWIDTH
-						}
-					}
-				}
-			} else if mod == tcell.ModCtrl {
-				switch key {
-				case tcell.KeyLeft:
-					if CURSORY+OFFSETY > 0 {
-						// Only allow moving right if not past end of line
-						if CURSORX-LINECOUNTWIDTH+OFFSETX > 0 {
-							currChar := 'a'
-							// While loop here
-							for currChar != ' ' {
-								CURSORX--
-								// Horizontal scroll right if needed
-								if CURSORX < COLS-LINECOUNTWIDTH {
-									OFFSETX--
-									CURSORX = COLS - LINECOUNTWIDTH - 1
-								}
-								// Check bounds before accessing array
-								currentPos := CURSORX - LINECOUNTWIDTH + OFFSETX
-								if currentPos == 0 {
-									currChar = ' '
-									break
-								}
-								currChar = TEXTBUFFER[CURSORY+OFFSETY][currentPos]
-							}
-						}
-					}
-				case tcell.KeyRight:
-					if CURSORY+OFFSETY < len(TEXTBUFFER) {
-						// Only allow moving right if not past end of line
-						lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
-						if CURSORX-LINECOUNTWIDTH+OFFSETX < lineLen {
-							currChar := 'a'
-							// While loop here
-							for currChar != ' ' {
-								CURSORX++
-								// Horizontal scroll right if needed
-								if CURSORX >= COLS-LINECOUNTWIDTH {
-									OFFSETX++
-									CURSORX = COLS - LINECOUNTWIDTH - 1
-								}
-								// Check bounds before accessing array
-								currentPos := CURSORX - LINECOUNTWIDTH + OFFSETX
-								if currentPos >= lineLen {
-									currChar = ' '
-									break
-								}
-								currChar = TEXTBUFFER[CURSORY+OFFSETY][currentPos]
-							}
-						}
-					}
-				default:
-				}
-			} else if mod == tcell.ModAlt {
-
-			}
-
-			// Ensure cursor stays within bounds
-			if CURSORY < 0 {
-				CURSORY = 0
-			}
-
-			if CURSORY >= ROWS {
-				CURSORY = ROWS - 1
-			}
-
-			if CURSORX < LINECOUNTWIDTH {
-				CURSORX = LINECOUNTWIDTH
+			if stay, _ := handleWriteKey(ev); !stay {
+				return
 			}
+		case *EventTick:
+			handleTick()
+		case *tcell.EventFocus:
+			handleFocus(ev)
+		}
 
-			if CURSORX >= COLS+LINECOUNTWIDTH {
-				CURSORX = COLS + LINECOUNTWIDTH - 1
-			}
+		//TODO:termbox.SetCursor(CURSORX, CURSORY)
+		UpdateSwapFiles()
+		TERMINAL.Clear()
+		DisplayBuffer()
+		DisplayStatus()
+		ShowCursor()
+		TERMINAL.Show()
+	}
+}
 
-			//TODO:termbox.SetCursor(CURSORX, CURSORY)
-			TERMINAL.Clear()
-			DisplayBuffer()
-			DisplayStatus()
-			TERMINAL.ShowCursor(CURSORX, CURSORY)
-			TERMINAL.Show()
-		}
+// refuseReadOnly tells the user the active buffer is read-only, returning true if edits should be refused
+func refuseReadOnly() bool {
+	if READONLY {
+		STATUSMESSAGE = "Buffer is read-only, use ro to allow edits"
 	}
+	return READONLY
 }
 
 func insertEnter() {
+	if refuseReadOnly() {
+		return
+	}
 	CursorPosXinBuffer := CURSORX - LINECOUNTWIDTH + OFFSETX
 	CursorPosYinBuffer := CURSORY + OFFSETY
 
@@ -221,28 +62,23 @@ func insertEnter() {
 		CursorPosXinBuffer = len(TEXTBUFFER[CursorPosYinBuffer])
 	}
 
-	currentLine := TEXTBUFFER[CursorPosYinBuffer]
-	beforeCursor := make([]rune, CursorPosXinBuffer)
-	copy(beforeCursor, currentLine[:CursorPosXinBuffer])
-
-	afterCursor := make([]rune, len(currentLine)-CursorPosXinBuffer)
-	copy(afterCursor, currentLine[CursorPosXinBuffer:])
-
-	newTEXTBUFFER := make([][]rune, len(TEXTBUFFER)+1)
-
-	copy(newTEXTBUFFER[:CursorPosYinBuffer], TEXTBUFFER[:CursorPosYinBuffer])
-
-	newTEXTBUFFER[CursorPosYinBuffer] = beforeCursor
-	newTEXTBUFFER[CursorPosYinBuffer+1] = afterCursor
-
-	copy(newTEXTBUFFER[CursorPosYinBuffer+2:], TEXTBUFFER[CursorPosYinBuffer+1:])
-	TEXTBUFFER = newTEXTBUFFER
+	bufferSplitLine(CursorPosYinBuffer, CursorPosXinBuffer)
+	HISTORY.Record(Edit{
+		Kind:   EditSplitLine,
+		Line:   CursorPosYinBuffer,
+		Col:    CursorPosXinBuffer,
+		Before: BufferPos{CursorPosYinBuffer, CursorPosXinBuffer},
+		After:  BufferPos{CursorPosYinBuffer + 1, 0},
+	})
 	CURSORX = LINECOUNTWIDTH
 	CURSORY++
 
 }
 
 func insertRune(insertrune rune) {
+	if refuseReadOnly() {
+		return
+	}
 	CursorPosXinBuffer := CURSORX - LINECOUNTWIDTH + OFFSETX
 	CursorPosYinBuffer := CURSORY + OFFSETY
 
@@ -255,16 +91,22 @@ func insertRune(insertrune rune) {
 		return
 	}
 
-	line := TEXTBUFFER[CursorPosYinBuffer]
-	newLine := make([]rune, len(line)+1)
-	copy(newLine, line[:CursorPosXinBuffer])
-	newLine[CursorPosXinBuffer] = insertrune
-	copy(newLine[CursorPosXinBuffer+1:], line[CursorPosXinBuffer:])
-	TEXTBUFFER[CursorPosYinBuffer] = newLine
+	bufferInsertRune(CursorPosYinBuffer, CursorPosXinBuffer, insertrune)
+	HISTORY.Record(Edit{
+		Kind:   EditInsertRune,
+		Line:   CursorPosYinBuffer,
+		Col:    CursorPosXinBuffer,
+		Char:   insertrune,
+		Before: BufferPos{CursorPosYinBuffer, CursorPosXinBuffer},
+		After:  BufferPos{CursorPosYinBuffer, CursorPosXinBuffer + 1},
+	})
 	CURSORX++
 }
 
 func deleteAtCursor() {
+	if refuseReadOnly() {
+		return
+	}
 	CursorPosXinBuffer := CURSORX - LINECOUNTWIDTH + OFFSETX
 	CursorPosYinBuffer := CURSORY + OFFSETY
 
@@ -274,25 +116,221 @@ func deleteAtCursor() {
 
 	if CursorPosXinBuffer <= 0 {
 		if CursorPosYinBuffer > 0 {
-			prevLineLength := len(TEXTBUFFER[CursorPosYinBuffer-1])
-
-			TEXTBUFFER[CursorPosYinBuffer-1] = append(TEXTBUFFER[CursorPosYinBuffer-1], TEXTBUFFER[CursorPosYinBuffer]...)
-
-			newTEXTBUFFER := make([][]rune, len(TEXTBUFFER)-1)
-			copy(newTEXTBUFFER[:CursorPosYinBuffer], TEXTBUFFER[:CursorPosYinBuffer])
-			copy(newTEXTBUFFER[CursorPosYinBuffer:], TEXTBUFFER[CursorPosYinBuffer+1:])
-			TEXTBUFFER = newTEXTBUFFER
+			prevLineLength := bufferJoinLine(CursorPosYinBuffer - 1)
+			HISTORY.Record(Edit{
+				Kind:   EditJoinLine,
+				Line:   CursorPosYinBuffer - 1,
+				Col:    prevLineLength,
+				Before: BufferPos{CursorPosYinBuffer, 0},
+				After:  BufferPos{CursorPosYinBuffer - 1, prevLineLength},
+			})
 			CURSORX = prevLineLength + LINECOUNTWIDTH
 			CURSORY--
 			return
 		}
 	} else {
 		if CursorPosXinBuffer <= len(TEXTBUFFER[CursorPosYinBuffer]) {
-			beforeSlice := TEXTBUFFER[CursorPosYinBuffer][:CursorPosXinBuffer-1]
-			afterSlice := TEXTBUFFER[CursorPosYinBuffer][CursorPosXinBuffer:]
-			TEXTBUFFER[CursorPosYinBuffer] = append(beforeSlice, afterSlice...)
+			deleted := bufferDeleteRune(CursorPosYinBuffer, CursorPosXinBuffer-1)
+			HISTORY.Record(Edit{
+				Kind:   EditDeleteRune,
+				Line:   CursorPosYinBuffer,
+				Col:    CursorPosXinBuffer - 1,
+				Char:   deleted,
+				Before: BufferPos{CursorPosYinBuffer, CursorPosXinBuffer},
+				After:  BufferPos{CursorPosYinBuffer, CursorPosXinBuffer - 1},
+			})
 			CURSORX--
 			return
 		}
 	}
 }
+
+// handleWriteKey applies a key pressed in WriteLoop to the buffer. Returns false for Esc, which leaves WriteLoop,
+// and whether a key binding took the key, including the first keys of a chord, rather than it editing the buffer
+func handleWriteKey(ev *tcell.EventKey) (bool, bool) {
+	STATUSMESSAGE = ""
+	LASTINPUT = time.Now()
+	if HandleKeymap(WRITEKEYS, ev) {
+		return true, true
+	}
+	mod, key, ch := ev.Modifiers(), ev.Key(), ev.Rune()
+	if mod == tcell.ModNone {
+		switch key {
+		case tcell.KeyUp:
+			if CURSORY > 0 {
+				// Move cursor up within visible area
+				CURSORY--
+			} else if OFFSETY > 0 {
+				// Scroll up when cursor is at top
+				OFFSETY--
+			}
+			// Adjust cursor X if moving to a shorter line
+			if CURSORY+OFFSETY < len(TEXTBUFFER) && CURSORX-LINECOUNTWIDTH > len(TEXTBUFFER[CURSORY+OFFSETY]) {
+				CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
+			}
+		case tcell.KeyDown:
+			if CURSORY < ROWS-1 && CURSORY+OFFSETY+1 < len(TEXTBUFFER) {
+				// Move cursor down within visible area
+				CURSORY++
+			} else if OFFSETY+ROWS < len(TEXTBUFFER) {
+				// Scroll down when cursor is at bottom
+				OFFSETY++
+			}
+			// Adjust cursor X if moving to a shorter line
+			if CURSORY+OFFSETY < len(TEXTBUFFER) && CURSORX-LINECOUNTWIDTH > len(TEXTBUFFER[CURSORY+OFFSETY]) {
+				CURSORX = len(TEXTBUFFER[CURSORY+OFFSETY]) + LINECOUNTWIDTH
+			}
+		case tcell.KeyLeft:
+			if CURSORX > LINECOUNTWIDTH {
+				CURSORX--
+				// Horizontal scroll left if needed
+				if CURSORX < LINECOUNTWIDTH {
+					CURSORX = LINECOUNTWIDTH
+				}
+			} else if OFFSETX > 0 {
+				OFFSETX--
+			}
+		case tcell.KeyRight:
+			if CURSORY+OFFSETY < len(TEXTBUFFER) {
+				// Only allow moving right if not past end of line
+				lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
+				if CURSORX-LINECOUNTWIDTH+OFFSETX < lineLen {
+					CURSORX++
+					// Horizontal scroll right if needed
+					if CURSORX >= COLS+LINECOUNTWIDTH {
+						OFFSETX++
+						CURSORX = COLS + LINECOUNTWIDTH - 1
+					}
+				}
+			}
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			// If at the left edge and more to the left, scroll left before deleting
+			if CURSORX == LINECOUNTWIDTH && OFFSETX > 0 {
+				OFFSETX--
+			}
+			deleteAtCursor()
+			// Auto-scroll if cursor goes above visible area
+			if CURSORY < 0 {
+				OFFSETY += CURSORY
+				CURSORY = 0
+			}
+			// After deletion, if no characters are visible in the current row, scroll left
+			visibleRow := CURSORY + OFFSETY
+			if visibleRow >= 0 && visibleRow < len(TEXTBUFFER) {
+				line := TEXTBUFFER[visibleRow]
+				if OFFSETX >= len(line) && OFFSETX > 0 {
+					OFFSETX--
+					CURSORX++
+				}
+			}
+			// Horizontal scroll left if needed after delete
+			if CURSORX < LINECOUNTWIDTH && OFFSETX > 0 {
+				OFFSETX--
+				CURSORX = LINECOUNTWIDTH
+			}
+			// If at left edge and more to the left, scroll to show next char to be deleted
+			if CURSORX == LINECOUNTWIDTH && OFFSETX > 0 {
+				OFFSETX--
+			}
+		case tcell.KeyEnter:
+			insertEnter()
+			// Auto-scroll if cursor goes below visible area
+			if CURSORY >= ROWS {
+				OFFSETY += CURSORY - ROWS + 1
+				CURSORY = ROWS - 1
+			}
+		case tcell.KeyEsc:
+			return false, false
+		default:
+			insertRune(ch)
+			// Ensure cursor is visible after insertion (horizontal scroll)
+			if CURSORX >= COLS+LINECOUNTWIDTH {
+				OFFSETX++
+				CURSORX = COLS + LINECOUNTWIDTH - 1
+			}
+			if CURSORX < LINECOUNTWIDTH {
+				if OFFSETX > 0 {
+					OFFSETX--
+					CURSORX = LINECOUNTWIDTH
+				}
+			}
+			// Clamp cursor to end of line after insert
+			lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
+			if CURSORX-LINECOUNTWIDTH+OFFSETX > lineLen {
+				CURSORX = lineLen - OFFSETX + LINECOUNTWIDTH
+				if CURSORX < LINECOUNTWIDTH {
+					CURSORX = LINECOUNTWIDTH
+				}
+			}
+		}
+	} else if mod == tcell.ModCtrl {
+		switch key {
+		case tcell.KeyLeft:
+			if CURSORY+OFFSETY > 0 {
+				// Only allow moving right if not past end of line
+				if CURSORX-LINECOUNTWIDTH+OFFSETX > 0 {
+					currChar := 'a'
+					// While loop here
+					for currChar != ' ' {
+						CURSORX--
+						// Horizontal scroll right if needed
+						if CURSORX < COLS-LINECOUNTWIDTH {
+							OFFSETX--
+							CURSORX = COLS - LINECOUNTWIDTH - 1
+						}
+						// Check bounds before accessing array
+						currentPos := CURSORX - LINECOUNTWIDTH + OFFSETX
+						if currentPos == 0 {
+							currChar = ' '
+							break
+						}
+						currChar = TEXTBUFFER[CURSORY+OFFSETY][currentPos]
+					}
+				}
+			}
+		case tcell.KeyRight:
+			if CURSORY+OFFSETY < len(TEXTBUFFER) {
+				// Only allow moving right if not past end of line
+				lineLen := len(TEXTBUFFER[CURSORY+OFFSETY])
+				if CURSORX-LINECOUNTWIDTH+OFFSETX < lineLen {
+					currChar := 'a'
+					// While loop here
+					for currChar != ' ' {
+						CURSORX++
+						// Horizontal scroll right if needed
+						if CURSORX >= COLS-LINECOUNTWIDTH {
+							OFFSETX++
+							CURSORX = COLS - LINECOUNTWIDTH - 1
+						}
+						// Check bounds before accessing array
+						currentPos := CURSORX - LINECOUNTWIDTH + OFFSETX
+						if currentPos >= lineLen {
+							currChar = ' '
+							break
+						}
+						currChar = TEXTBUFFER[CURSORY+OFFSETY][currentPos]
+					}
+				}
+			}
+		default:
+		}
+	}
+
+	// Ensure cursor stays within bounds
+	if CURSORY < 0 {
+		CURSORY = 0
+	}
+
+	if CURSORY >= ROWS {
+		CURSORY = ROWS - 1
+	}
+
+	if CURSORX < LINECOUNTWIDTH {
+		CURSORX = LINECOUNTWIDTH
+	}
+
+	if CURSORX >= COLS+LINECOUNTWIDTH {
+		CURSORX = COLS + LINECOUNTWIDTH - 1
+	}
+	return true, false
+}
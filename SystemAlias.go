@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BUILTINALIASES are the short names every command line knows. Aliases in config.json are added to them,
+// and replace them when they have the same name
+var BUILTINALIASES = map[string]string{
+	"q":   "quit",
+	"w":   "write",
+	"o":   "open",
+	"s":   "save",
+	"sa":  "saveas",
+	"vs":  "visual",
+	"u":   "undo",
+	"r":   "redo",
+	"c":   "clear",
+	"sp":  "split",
+	"vsp": "vsplit",
+	"wq":  "save; quit",
+}
+
+// ALIASES maps alias names to the commands they stand for, which may be several separated by ";"
+var ALIASES = map[string]string{}
+
+// applyAliases sets ALIASES to the built-in aliases and the ones from config.json
+func applyAliases(configured map[string]string) {
+	ALIASES = map[string]string{}
+	for name, command := range BUILTINALIASES {
+		ALIASES[name] = command
+	}
+	for name, command := range configured {
+		ALIASES[strings.ToLower(name)] = command
+	}
+}
+
+// SplitCommands splits a command line into the commands separated by ";" outside quotes. "\;" doesn't separate
+func SplitCommands(line string) []string {
+	var commands []string
+	start := 0
+	var quote rune
+	escaped := false
+	for i, char := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else if char == '\\' && quote == '"' {
+				escaped = true
+			}
+		case char == '\\':
+			escaped = true
+		case char == '"' || char == '\'':
+			quote = char
+		case char == ';':
+			commands = append(commands, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(commands, line[start:])
+}
+
+// splitCommandName splits a command into its first word and the text after it, spaces included
+func splitCommandName(command string) (string, string) {
+	command = strings.TrimLeftFunc(command, unicode.IsSpace)
+	end := strings.IndexFunc(command, unicode.IsSpace)
+	if end < 0 {
+		return command, ""
+	}
+	return command[:end], command[end:]
+}
+
+// ExpandAliases splits a command line into its commands and replaces every alias with what it stands for.
+// Arguments after an alias are added to the end of its last command, like in a shell.
+// An alias that leads back to itself is an error, unless it names a command, so "open" can stand for "open notes.txt"
+func ExpandAliases(line string) ([]string, error) {
+	return expandAliases(line, nil)
+}
+
+// expandAliases expands the aliases in a command line, with chain holding the aliases it came from
+func expandAliases(line string, chain []string) ([]string, error) {
+	var commands []string
+	for _, command := range SplitCommands(line) {
+		name, rest := splitCommandName(command)
+		name = strings.ToLower(name)
+		expansion, ok := ALIASES[name]
+		if ok && containsString(chain, name) {
+			if FindCommand(name) == nil {
+				return nil, fmt.Errorf("failed to expand alias: %s leads back to itself", strings.Join(append(chain, name), " -> "))
+			}
+			ok = false
+		}
+		if !ok {
+			commands = append(commands, command)
+			continue
+		}
+		expanded, err := expandAliases(expansion+rest, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, expanded...)
+	}
+	return commands, nil
+}
+
+// containsString reports whether a list holds a string
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCommandName returns the command an alias finally runs, or the name itself when it isn't an alias
+func resolveCommandName(name string) string {
+	commands, err := ExpandAliases(name)
+	if err != nil || len(commands) == 0 {
+		return strings.ToLower(name)
+	}
+	resolved, _ := splitCommandName(commands[len(commands)-1])
+	return strings.ToLower(resolved)
+}
+
+// setAlias is the alias command. Without arguments it lists the aliases, with a name it shows that alias,
+// and with a name and a command it defines the alias for this session. unalias removes one
+func setAlias(args []string) {
+	switch len(args) {
+	case 0:
+		var names []string
+		for name := range ALIASES {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			names[i] = name + "=" + ALIASES[name]
+		}
+		STATUSMESSAGE = "Aliases: " + strings.Join(names, ", ")
+		return
+	case 1:
+		command, ok := ALIASES[strings.ToLower(args[0])]
+		if !ok {
+			STATUSMESSAGE = fmt.Sprintf("No alias %s", args[0])
+			return
+		}
+		STATUSMESSAGE = fmt.Sprintf("%s = %s", strings.ToLower(args[0]), command)
+		return
+	}
+
+	name := strings.ToLower(args[0])
+	// A single argument is the whole command, so "save; quit" can be quoted. Several are quoted again where needed
+	command := args[1]
+	if len(args) > 2 {
+		command = JoinCommand(args[1:])
+	}
+	old, existed := ALIASES[name]
+	ALIASES[name] = command
+	if _, err := ExpandAliases(name); err != nil {
+		if existed {
+			ALIASES[name] = old
+		} else {
+			delete(ALIASES, name)
+		}
+		STATUSMESSAGE = err.Error()
+		return
+	}
+	STATUSMESSAGE = fmt.Sprintf("%s = %s", name, command)
+}
+
+// removeAlias is the unalias command
+func removeAlias(args []string) {
+	if len(args) != 1 {
+		STATUSMESSAGE = "Usage: unalias <name>"
+		return
+	}
+	name := strings.ToLower(args[0])
+	if _, ok := ALIASES[name]; !ok {
+		STATUSMESSAGE = fmt.Sprintf("No alias %s", args[0])
+		return
+	}
+	delete(ALIASES, name)
+	STATUSMESSAGE = fmt.Sprintf("Removed alias %s", name)
+}
+
+// JoinCommand joins words into a command that ParseCommand splits back into the same words
+func JoinCommand(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		if word != "" && !strings.ContainsAny(word, " \t\"'\\;") {
+			quoted[i] = word
+			continue
+		}
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// EventTick is posted into the tcell event loop every TICKINTERVAL, so timed work like
+// autosave and swap files happens even while no keys are pressed
+type EventTick struct {
+	tcell.EventTime
+}
+
+const TICKINTERVAL = time.Second
+
+// AUTOSAVEIDLE saves the active buffer after this long without input, zero turns it off.
+// AUTOSAVEONFOCUSLOST saves it when the terminal loses focus.
+// Both start out from Settings and can be changed for the session with the autosave command
+var AUTOSAVEIDLE time.Duration
+var AUTOSAVEONFOCUSLOST bool
+
+// LASTINPUT is when the last key was pressed, lastAutosave when the idle autosave last ran
+var LASTINPUT = time.Now()
+var lastAutosave time.Time
+
+// StartTicker posts an EventTick into the event loop every TICKINTERVAL for as long as STE runs
+func StartTicker() {
+	go func() {
+		ticker := time.NewTicker(TICKINTERVAL)
+		for range ticker.C {
+			tick := &EventTick{}
+			tick.SetEventNow()
+			// A full event queue means the loop is busy anyway, so the tick can be dropped
+			TERMINAL.PostEvent(tick)
+		}
+	}()
+}
+
+// handleTick looks for changes to the active buffer's file on disk, and runs the idle autosave once per idle period
+func handleTick() {
+	checkExternalChange()
+	if AUTOSAVEIDLE > 0 && time.Since(LASTINPUT) >= AUTOSAVEIDLE && lastAutosave.Before(LASTINPUT) {
+		lastAutosave = time.Now()
+		autosave()
+	}
+}
+
+// handleFocus saves the active buffer when the terminal loses focus, if that is turned on
+func handleFocus(ev *tcell.EventFocus) {
+	if AUTOSAVEONFOCUSLOST && !ev.Focused {
+		autosave()
+	}
+}
+
+// autosave saves the active buffer through SaveCurrentState, if it has unsaved changes and a file to go to.
+// Read-only buffers and files that changed on disk are left for the user to sort out
+func autosave() {
+	if !MODIFIED || SOURCEFILE == "" || READONLY {
+		return
+	}
+	if _, changed := diskChanged(SOURCEFILE, DISKSTATE); changed {
+		return
+	}
+	SaveCurrentState()
+}
+
+// setAutosave changes the autosave mode for this session from the autosave command's arguments:
+// "off", "focus" to toggle saving on focus loss, or a number of idle seconds
+func setAutosave(args []string) {
+	if len(args) == 0 {
+		STATUSMESSAGE = "Autosave: " + autosaveDescription()
+		return
+	}
+	switch args[0] {
+	case "off":
+		AUTOSAVEIDLE = 0
+		AUTOSAVEONFOCUSLOST = false
+	case "focus":
+		AUTOSAVEONFOCUSLOST = !AUTOSAVEONFOCUSLOST
+	default:
+		seconds, err := strconv.Atoi(args[0])
+		if err != nil || seconds < 0 {
+			STATUSMESSAGE = fmt.Sprintf("Autosave needs off, focus or a number of seconds, not %q", args[0])
+			return
+		}
+		AUTOSAVEIDLE = time.Duration(seconds) * time.Second
+	}
+	STATUSMESSAGE = "Autosave: " + autosaveDescription()
+}
+
+// autosaveDescription describes the current autosave mode, like "30s,focus"
+func autosaveDescription() string {
+	var modes []string
+	if AUTOSAVEIDLE > 0 {
+		modes = append(modes, AUTOSAVEIDLE.String())
+	}
+	if AUTOSAVEONFOCUSLOST {
+		modes = append(modes, "focus")
+	}
+	if len(modes) == 0 {
+		return "off"
+	}
+	return strings.Join(modes, ",")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// BrowserEntry is one line of a directory browser buffer
+type BrowserEntry struct {
+	Name  string
+	IsDir bool
+	// Kind is "dir", "file", "link" or "other"
+	Kind string
+	Size int64
+}
+
+// ListDirectory reads a directory for a browser buffer: a ".." entry for the parent,
+// then the directories and then the files, each sorted by name
+func ListDirectory(dir string) ([]BrowserEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var entries []BrowserEntry
+	for _, dirEntry := range dirEntries {
+		entry := BrowserEntry{Name: dirEntry.Name(), Kind: "other"}
+		info, err := os.Stat(filepath.Join(dir, dirEntry.Name()))
+		if err == nil {
+			entry.IsDir = info.IsDir()
+			entry.Size = info.Size()
+		}
+		switch {
+		case dirEntry.Type()&os.ModeSymlink != 0:
+			entry.Kind = "link"
+		case entry.IsDir:
+			entry.Kind = "dir"
+		case dirEntry.Type().IsRegular():
+			entry.Kind = "file"
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return append([]BrowserEntry{{Name: "..", IsDir: true, Kind: "dir"}}, entries...), nil
+}
+
+// browserLines formats the entries of a directory as the text of its browser buffer
+func browserLines(entries []BrowserEntry) [][]rune {
+	lines := make([][]rune, len(entries))
+	for i, entry := range entries {
+		name, size := entry.Name, humanSize(entry.Size)
+		if entry.IsDir {
+			name += "/"
+			size = "-"
+		}
+		lines[i] = []rune(fmt.Sprintf("%-5s %7s  %s", entry.Kind, size, name))
+	}
+	return lines
+}
+
+// humanSize formats a size in bytes like ls -h does
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d", size)
+	}
+	value, suffix := float64(size)/unit, 0
+	for value >= unit && suffix < 4 {
+		value /= unit
+		suffix++
+	}
+	return fmt.Sprintf("%.1f%c", value, "KMGTP"[suffix])
+}
+
+// OpenDirectory shows a directory in a browser buffer, reusing the one already showing it
+func OpenDirectory(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	storeActiveBuffer()
+	for i, buffer := range BUFFERS {
+		if buffer.Directory == dir {
+			SwitchBuffer(i)
+			return RefreshDirectory()
+		}
+	}
+
+	entries, err := ListDirectory(dir)
+	if err != nil {
+		return err
+	}
+	AddBuffer(browserLines(entries), DefaultFileFormat(), "")
+	buffer := BUFFERS[CURRENTBUFFER]
+	buffer.Directory = dir
+	buffer.entries = entries
+	READONLY = true
+	return nil
+}
+
+// RefreshDirectory lists the active browser buffer's directory again, keeping the cursor where it can
+func RefreshDirectory() error {
+	buffer := BUFFERS[CURRENTBUFFER]
+	entries, err := ListDirectory(buffer.Directory)
+	if err != nil {
+		return err
+	}
+	buffer.entries = entries
+	position := CursorPosition()
+	TEXTBUFFER = browserLines(entries)
+	MoveCursorTo(position.Line, 0)
+	return nil
+}
+
+// isDirectory reports whether a path is an existing directory
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
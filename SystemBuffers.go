@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Buffer holds the state of one open file.
+// The active buffer lives in the globals (TEXTBUFFER, SOURCEFILE, CURSORX...), and is only
+// copied back into its Buffer when another buffer is made active
+type Buffer struct {
+	TextBuffer [][]rune
+	SourceFile string
+	Format     FileFormat
+	// CursorX is relative to the text area, so it does not depend on LINECOUNTWIDTH
+	CursorX  int
+	CursorY  int
+	OffsetX  int
+	OffsetY  int
+	Modified bool
+	ReadOnly bool
+	History  *EditHistory
+	// DiskState is the version of SourceFile the buffer was read from or last saved to
+	DiskState  DiskState
+	diskWarned DiskState
+	// SwapPath is the buffer's swap file, empty while it has none.
+	// swapChanges is History.Changes at the last swap write, and swapTime when that happened
+	SwapPath    string
+	swapChanges int
+	swapTime    time.Time
+	// lockPath is the lock file this instance holds for SourceFile, empty while it holds none
+	lockPath string
+	// Directory is set for browser buffers, which list the entries of that directory instead of holding a file
+	Directory string
+	entries   []BrowserEntry
+}
+
+// BUFFERS holds every open buffer, CURRENTBUFFER is the index of the active one
+var BUFFERS = []*Buffer{{TextBuffer: TEXTBUFFER, Format: FILEFORMAT, History: HISTORY}}
+var CURRENTBUFFER = 0
+
+// storeActiveBuffer copies the globals back into the active buffer
+func storeActiveBuffer() {
+	buffer := BUFFERS[CURRENTBUFFER]
+	buffer.TextBuffer = TEXTBUFFER
+	buffer.SourceFile = SOURCEFILE
+	buffer.Format = FILEFORMAT
+	buffer.CursorX = CURSORX - LINECOUNTWIDTH
+	buffer.CursorY = CURSORY
+	buffer.OffsetX = OFFSETX
+	buffer.OffsetY = OFFSETY
+	buffer.Modified = MODIFIED
+	buffer.ReadOnly = READONLY
+	buffer.History = HISTORY
+	buffer.DiskState = DISKSTATE
+	buffer.diskWarned = diskWarned
+}
+
+// loadBuffer makes the buffer at index the active one by copying it into the globals
+func loadBuffer(index int) {
+	CURRENTBUFFER = index
+	buffer := BUFFERS[index]
+	TEXTBUFFER = buffer.TextBuffer
+	SOURCEFILE = buffer.SourceFile
+	FILEFORMAT = buffer.Format
+	OFFSETX = buffer.OffsetX
+	OFFSETY = buffer.OffsetY
+	MODIFIED = buffer.Modified
+	READONLY = buffer.ReadOnly
+	HISTORY = buffer.History
+	DISKSTATE = buffer.DiskState
+	diskWarned = buffer.diskWarned
+	// Another pane may have edited the buffer since, or be a different size, so the cursor is clamped
+	MoveCursorTo(buffer.OffsetY+buffer.CursorY, buffer.OffsetX+buffer.CursorX)
+}
+
+// SwitchBuffer makes the buffer at index the active one. Returns false if there is no such buffer
+func SwitchBuffer(index int) bool {
+	if index < 0 || index >= len(BUFFERS) {
+		return false
+	}
+	storeActiveBuffer()
+	loadBuffer(index)
+	return true
+}
+
+// NextBuffer switches to the buffer after the active one, wrapping around
+func NextBuffer() {
+	SwitchBuffer((CURRENTBUFFER + 1) % len(BUFFERS))
+}
+
+// PrevBuffer switches to the buffer before the active one, wrapping around
+func PrevBuffer() {
+	SwitchBuffer((CURRENTBUFFER - 1 + len(BUFFERS)) % len(BUFFERS))
+}
+
+// AddBuffer opens textBuffer as a new buffer and makes it active, locking its file.
+// An untouched, unnamed active buffer is replaced instead of kept around.
+// Returns false if the file is locked by another STE and the user chose not to open it
+func AddBuffer(textBuffer [][]rune, format FileFormat, filename string) bool {
+	storeActiveBuffer()
+	buffer := &Buffer{TextBuffer: textBuffer, SourceFile: filename, Format: format, History: &EditHistory{}}
+	if filename != "" {
+		lockPath, readOnly, ok := acquireLock(filename)
+		if !ok {
+			return false
+		}
+		buffer.lockPath = lockPath
+		buffer.DiskState = ReadDiskState(filename)
+		buffer.ReadOnly = readOnly || !fileWritable(filename)
+		restorePosition(buffer)
+	}
+
+	if isScratchBuffer(BUFFERS[CURRENTBUFFER]) {
+		BUFFERS[CURRENTBUFFER] = buffer
+	} else {
+		BUFFERS = append(BUFFERS, buffer)
+		CURRENTBUFFER = len(BUFFERS) - 1
+	}
+	loadBuffer(CURRENTBUFFER)
+	syncPanesWithBuffers()
+	RememberBuffer(buffer)
+	return true
+}
+
+// CloseBuffer removes the active buffer without asking about unsaved changes.
+// When the last buffer is closed an empty one takes its place
+func CloseBuffer() {
+	storeActiveBuffer()
+	RememberBuffer(BUFFERS[CURRENTBUFFER])
+	removeSwapFile(BUFFERS[CURRENTBUFFER])
+	releaseLock(BUFFERS[CURRENTBUFFER])
+	BUFFERS = append(BUFFERS[:CURRENTBUFFER], BUFFERS[CURRENTBUFFER+1:]...)
+	if len(BUFFERS) == 0 {
+		BUFFERS = []*Buffer{{TextBuffer: [][]rune{{}}, Format: DefaultFileFormat(), History: &EditHistory{}}}
+	}
+	if CURRENTBUFFER >= len(BUFFERS) {
+		CURRENTBUFFER = len(BUFFERS) - 1
+	}
+	loadBuffer(CURRENTBUFFER)
+	syncPanesWithBuffers()
+}
+
+// FindBuffer returns the index of the buffer editing filename, or -1 if it isn't open
+func FindBuffer(filename string) int {
+	storeActiveBuffer()
+	target, err := filepath.Abs(filename)
+	if err != nil {
+		return -1
+	}
+	for i, buffer := range BUFFERS {
+		if buffer.SourceFile == "" {
+			continue
+		}
+		path, err := filepath.Abs(buffer.SourceFile)
+		if err == nil && path == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfBuffer returns the index of buffer in BUFFERS, or -1 if it was closed
+func indexOfBuffer(buffer *Buffer) int {
+	for i, open := range BUFFERS {
+		if open == buffer {
+			return i
+		}
+	}
+	return -1
+}
+
+// BufferName returns the name a buffer is listed under
+func BufferName(buffer *Buffer) string {
+	if buffer.Directory != "" {
+		if strings.HasSuffix(buffer.Directory, string(os.PathSeparator)) {
+			return buffer.Directory
+		}
+		return buffer.Directory + string(os.PathSeparator)
+	}
+	if buffer.SourceFile == "" {
+		return "[No Name]"
+	}
+	return buffer.SourceFile
+}
+
+// isScratchBuffer reports whether a buffer is the empty, unnamed one STE starts with.
+// The --filter buffer never is, even when stdin was empty, since it is written to stdout on quit
+func isScratchBuffer(buffer *Buffer) bool {
+	return buffer != FILTERBUFFER &&
+		buffer.SourceFile == "" &&
+		!buffer.Modified &&
+		len(buffer.TextBuffer) == 1 &&
+		len(buffer.TextBuffer[0]) == 0 &&
+		len(buffer.History.UndoStack) == 0
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// VERSION is printed by --version
+const VERSION = "0.1.0"
+
+// Exit codes, following the convention that 2 means the command line was wrong
+const (
+	EXITOK    = 0
+	EXITERROR = 1
+	EXITUSAGE = 2
+)
+
+const USAGE = `Usage: ste [options] [file ...]
+
+Files:
+  file             open file, several files open as separate buffers
+  +N file          open file with the cursor on line N
+  file:N[:C]       open file with the cursor on line N, column C
+  -                read a buffer from stdin, like git log | ste -
+
+Options:
+  --readonly       open the files read-only, same as running STE as view
+  --view           same as --readonly
+  --restore        reopen the files that were open when STE last exited
+  --filter         write the first buffer to stdout on quit, reading stdin when no file is given
+  --config PATH    read and write settings at PATH instead of the default config.json
+  --theme NAME     use a built-in color theme for this session (default, light, dark)
+  -c COMMAND       run a status bar command after startup, can be repeated
+  --version        print the version and exit
+  -h, --help       print this help and exit
+`
+
+// FileArg is a file named on the command line, with the 1-based position to start at, 0 when not given.
+// Stdin is set for "-", which reads the buffer from stdin instead of a file
+type FileArg struct {
+	Path  string
+	Line  int
+	Col   int
+	Stdin bool
+}
+
+// CLIOptions is the parsed command line
+type CLIOptions struct {
+	Files    []FileArg
+	ReadOnly bool
+	Filter   bool
+	Restore  bool
+	Config   string
+	Theme    string
+	Commands []string
+	Help     bool
+	Version  bool
+}
+
+// ParseArgs parses the command line arguments, without the program name
+func ParseArgs(args []string) (CLIOptions, error) {
+	var options CLIOptions
+	// Set by +N, and used up by the file that follows it
+	pendingLine := 0
+	onlyFiles := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if onlyFiles || arg == "-" || !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+") {
+			var file FileArg
+			if arg == "-" && !onlyFiles {
+				if options.ReadsStdin() {
+					return options, fmt.Errorf("stdin can only be read once")
+				}
+				file = FileArg{Path: arg, Stdin: true}
+			} else {
+				file = parseFileArg(arg)
+			}
+			if pendingLine > 0 {
+				file.Line, file.Col = pendingLine, 0
+				pendingLine = 0
+			}
+			options.Files = append(options.Files, file)
+			continue
+		}
+
+		if strings.HasPrefix(arg, "+") {
+			line, err := strconv.Atoi(arg[1:])
+			if err != nil || line < 1 {
+				return options, fmt.Errorf("invalid line number %q", arg)
+			}
+			pendingLine = line
+			continue
+		}
+
+		// Options taking a value accept both "--name value" and "--name=value"
+		name, value, hasValue := strings.Cut(arg, "=")
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s needs a value", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch name {
+		case "--":
+			onlyFiles = true
+		case "-h", "--help":
+			options.Help = true
+		case "--version":
+			options.Version = true
+		case "--readonly", "--view":
+			options.ReadOnly = true
+		case "--filter":
+			options.Filter = true
+		case "--restore":
+			options.Restore = true
+		case "--config":
+			options.Config, err = takeValue()
+		case "--theme":
+			options.Theme, err = takeValue()
+		case "-c":
+			var command string
+			command, err = takeValue()
+			options.Commands = append(options.Commands, command)
+		default:
+			return options, fmt.Errorf("unknown option %s", name)
+		}
+		if err != nil {
+			return options, err
+		}
+	}
+
+	if pendingLine > 0 {
+		return options, fmt.Errorf("+%d must be followed by a file", pendingLine)
+	}
+	// A filter with nothing to open filters stdin
+	if options.Filter && len(options.Files) == 0 {
+		options.Files = append(options.Files, FileArg{Path: "-", Stdin: true})
+	}
+	return options, nil
+}
+
+// ReadsStdin reports whether one of the files is read from stdin
+func (options CLIOptions) ReadsStdin() bool {
+	for _, file := range options.Files {
+		if file.Stdin {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFileArg splits a trailing :line or :line:col off a file argument.
+// Names that exist as given are never split, so files with colons in their name still open
+func parseFileArg(arg string) FileArg {
+	if _, err := os.Stat(arg); err == nil {
+		return FileArg{Path: arg}
+	}
+
+	parts := strings.Split(arg, ":")
+	var numbers []int
+	for len(parts) > 1 && len(numbers) < 2 {
+		number, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil || number < 1 {
+			break
+		}
+		numbers = append([]int{number}, numbers...)
+		parts = parts[:len(parts)-1]
+	}
+
+	file := FileArg{Path: strings.Join(parts, ":")}
+	if len(numbers) > 0 {
+		file.Line = numbers[0]
+	}
+	if len(numbers) > 1 {
+		file.Col = numbers[1]
+	}
+	return file
+}
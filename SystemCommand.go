@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ParseCommand splits a status bar command into its name, lowercased, and its arguments.
+// Arguments are separated by spaces. Single quotes keep everything up to the closing quote as it is,
+// double quotes allow \" and \\ inside them, and outside quotes a backslash escapes a space, quote, backslash or ";".
+// Any other backslash is kept, so Windows paths can be typed as they are
+func ParseCommand(line string) (string, []string, error) {
+	var words []string
+	var word strings.Builder
+	// inWord is set once a word has started, so "" still gives an empty argument
+	inWord := false
+	var quote rune
+	escaped := false
+
+	chars := []rune(line)
+	for i, char := range chars {
+		switch {
+		case escaped:
+			word.WriteRune(char)
+			escaped = false
+		case quote == '\'':
+			if char == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(char)
+			}
+		case quote == '"':
+			if char == '"' {
+				quote = 0
+			} else if char == '\\' && i+1 < len(chars) && (chars[i+1] == '"' || chars[i+1] == '\\') {
+				escaped = true
+			} else {
+				word.WriteRune(char)
+			}
+		case char == '\'' || char == '"':
+			quote = char
+			inWord = true
+		case char == '\\' && i+1 < len(chars) && strings.ContainsRune(" \t'\"\\;", chars[i+1]):
+			escaped = true
+			inWord = true
+		case unicode.IsSpace(char):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(char)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return "", nil, fmt.Errorf("failed to parse command: missing closing %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return "", nil, nil
+	}
+	return strings.ToLower(words[0]), words[1:], nil
+}
+
+// Command is a status bar command, registered in COMMANDS
+type Command struct {
+	Name string
+	// Usage shows the arguments the command takes, like "[file]"
+	Usage       string
+	Description string
+	// MaxArgs is the most arguments the command takes, -1 for any number
+	MaxArgs int
+	// Files is set when the arguments are file names, so Tab completes them as paths
+	Files bool
+	Run   func(args []string)
+}
+
+// FindCommand returns the registered command with a name, or nil
+func FindCommand(name string) *Command {
+	for _, command := range COMMANDS {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// COMMANDCOMPLETIONS are the candidates the last Tab in the status bar found, shown above it until the next key
+var COMMANDCOMPLETIONS []string
+
+// CompleteCommand completes the word a status bar command ends in, after the last ";": the command name,
+// or a path for commands that take files. Returns the completed command, and the candidates when more than one fits
+func CompleteCommand(typed string) (string, []string) {
+	if commands := SplitCommands(typed); len(commands) > 1 {
+		last := commands[len(commands)-1]
+		completed, candidates := CompleteCommand(last)
+		return typed[:len(typed)-len(last)] + completed, candidates
+	}
+	fields := strings.Fields(typed)
+	newWord := typed == "" || strings.TrimRightFunc(typed, unicode.IsSpace) != typed
+	if len(fields) == 0 || len(fields) == 1 && !newWord {
+		prefix := ""
+		if len(fields) == 1 {
+			prefix = strings.ToLower(fields[0])
+		}
+		var candidates []string
+		var names []string
+		for _, command := range COMMANDS {
+			names = append(names, command.Name)
+		}
+		for name := range ALIASES {
+			if !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+		leading := typed[:len(typed)-len(strings.TrimLeftFunc(typed, unicode.IsSpace))]
+		switch len(candidates) {
+		case 0:
+			return typed, nil
+		case 1:
+			return leading + candidates[0] + " ", nil
+		}
+		return leading + commonPrefix(candidates), candidates
+	}
+
+	if command := FindCommand(resolveCommandName(fields[0])); command == nil || !command.Files {
+		return typed, nil
+	}
+	// The path starts after the last space that isn't inside quotes
+	start := 0
+	var quote rune
+	for i, char := range typed {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case unicode.IsSpace(char):
+			start = i + len(string(char))
+		}
+	}
+	word, opening := typed[start:], ""
+	if strings.HasPrefix(word, `"`) || strings.HasPrefix(word, "'") {
+		word, opening = word[1:], word[:1]
+	}
+	completed, candidates := CompletePath(word)
+	if opening == "" && strings.ContainsAny(completed, " \t") {
+		opening = `"`
+	}
+	// A file that is completed fully gets its quote closed, a directory is left open to type on into
+	closing := ""
+	if opening != "" && candidates == nil && completed != word && !strings.HasSuffix(completed, "/") {
+		closing = opening
+	}
+	return typed[:start] + opening + completed + closing, candidates
+}
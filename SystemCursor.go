@@ -0,0 +1,54 @@
+package main
+
+// CursorPosition returns the cursor's position in TEXTBUFFER
+func CursorPosition() BufferPos {
+	return BufferPos{
+		Line: CURSORY + OFFSETY,
+		Col:  CURSORX - LINECOUNTWIDTH + OFFSETX,
+	}
+}
+
+// MoveCursorTo places the cursor at a position in TEXTBUFFER, scrolling the view so it stays visible.
+// Positions outside the buffer are clamped to the nearest valid one
+func MoveCursorTo(line, col int) {
+	if line >= len(TEXTBUFFER) {
+		line = len(TEXTBUFFER) - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	if col > len(TEXTBUFFER[line]) {
+		col = len(TEXTBUFFER[line])
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	// ROWS and COLS are only known once the main loop has run, so never assume less than one cell
+	rows, cols := ROWS, COLS
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+
+	if line < OFFSETY {
+		OFFSETY = line
+	} else if line >= OFFSETY+rows {
+		OFFSETY = line - rows + 1
+	}
+	if col < OFFSETX {
+		OFFSETX = col
+	} else if col >= OFFSETX+cols {
+		OFFSETX = col - cols + 1
+	}
+
+	CURSORY = line - OFFSETY
+	CURSORX = col - OFFSETX + LINECOUNTWIDTH
+}
+
+// ShowCursor draws the terminal cursor at CURSORX, CURSORY inside the active pane
+func ShowCursor() {
+	TERMINAL.ShowCursor(ACTIVEPANE.X+CURSORX, ACTIVEPANE.Y+CURSORY)
+}
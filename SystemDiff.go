@@ -0,0 +1,84 @@
+package main
+
+// MAXDIFFCELLS caps the size of the table used to line up changed lines, beyond it changes are shown as one block
+const MAXDIFFCELLS = 4000000
+
+// DiffLines compares two versions of a text line by line. Removed lines are prefixed "- ",
+// added lines "+ " and unchanged lines "  "
+func DiffLines(oldLines, newLines []string) []string {
+	var diff []string
+
+	// Lines shared at the start and end are unchanged, only the middle needs comparing
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	for _, line := range oldLines[:prefix] {
+		diff = append(diff, "  "+line)
+	}
+	diff = append(diff, diffMiddle(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		diff = append(diff, "  "+line)
+	}
+	return diff
+}
+
+// diffMiddle lines up two texts by their longest common subsequence of lines
+func diffMiddle(oldLines, newLines []string) []string {
+	var diff []string
+
+	if len(oldLines)*len(newLines) > MAXDIFFCELLS {
+		for _, line := range oldLines {
+			diff = append(diff, "- "+line)
+		}
+		for _, line := range newLines {
+			diff = append(diff, "+ "+line)
+		}
+		return diff
+	}
+
+	// common[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) && j < len(newLines) {
+		if oldLines[i] == newLines[j] {
+			diff = append(diff, "  "+oldLines[i])
+			i++
+			j++
+		} else if common[i+1][j] >= common[i][j+1] {
+			diff = append(diff, "- "+oldLines[i])
+			i++
+		} else {
+			diff = append(diff, "+ "+newLines[j])
+			j++
+		}
+	}
+	for ; i < len(oldLines); i++ {
+		diff = append(diff, "- "+oldLines[i])
+	}
+	for ; j < len(newLines); j++ {
+		diff = append(diff, "+ "+newLines[j])
+	}
+	return diff
+}
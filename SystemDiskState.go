@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+// DiskState identifies the version of a file on disk, to notice when something else changes it
+type DiskState struct {
+	Exists  bool
+	ModTime time.Time
+	Size    int64
+	Hash    [sha256.Size]byte
+}
+
+// DISKSTATE is the version of SOURCEFILE the active buffer was read from or last saved to.
+// diskWarned is the version the user was last warned about, so the same change isn't reported twice
+var DISKSTATE DiskState
+var diskWarned DiskState
+
+// ReadDiskState records the current version of a file. Missing or unreadable files give a DiskState that doesn't exist
+func ReadDiskState(filename string) DiskState {
+	file, err := os.Open(filename)
+	if err != nil {
+		return DiskState{}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return DiskState{}
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return DiskState{}
+	}
+
+	state := DiskState{Exists: true, ModTime: info.ModTime(), Size: info.Size()}
+	copy(state.Hash[:], hasher.Sum(nil))
+	return state
+}
+
+// diskChanged compares a file on disk to a known version of it, returning the current version
+// and whether its content differs. Files that were deleted don't count as changed, saving just recreates them
+func diskChanged(filename string, known DiskState) (DiskState, bool) {
+	// A matching stat is trusted, so the file is only hashed again once it was touched
+	info, err := os.Stat(filename)
+	if err != nil {
+		return known, false
+	}
+	if known.Exists && info.ModTime().Equal(known.ModTime) && info.Size() == known.Size {
+		return known, false
+	}
+
+	current := ReadDiskState(filename)
+	if !current.Exists {
+		return known, false
+	}
+	if !known.Exists {
+		return current, true
+	}
+	return current, current.Hash != known.Hash
+}
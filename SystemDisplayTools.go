@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/mattn/go-runewidth"
@@ -23,44 +25,132 @@ func PrintMessageStyle(col, row int, style tcell.Style, msg string) {
 	}
 }
 
-// DisplayBuffer - Pass all needed data as parameters
+// WaitForKey blocks until a key is pressed, so a message stays up until the user has seen it
+func WaitForKey() {
+	for {
+		if _, ok := TERMINAL.PollEvent().(*tcell.EventKey); ok {
+			return
+		}
+	}
+}
+
+// DisplayBuffer draws every pane. The active pane is drawn from the globals, the others from their
+// stored state, reading the live TEXTBUFFER when they show the active buffer
 func DisplayBuffer() {
+	for _, pane := range PanesInOrder() {
+		if pane == ACTIVEPANE {
+			displayPane(TEXTBUFFER, pane.X, pane.Y, COLS, ROWS, OFFSETX, OFFSETY)
+			continue
+		}
+		textBuffer := pane.Buffer.TextBuffer
+		if pane.Buffer == BUFFERS[CURRENTBUFFER] {
+			textBuffer = TEXTBUFFER
+		}
+		displayPane(textBuffer, pane.X, pane.Y, pane.Width-LINECOUNTWIDTH, pane.Height-1, pane.OffsetX, pane.OffsetY)
+	}
+	displaySeparators(PANELAYOUT)
+	if SIDEBAR.Visible {
+		displaySidebar()
+	}
+}
+
+// displayPane draws a text buffer with its line numbers at a screen position
+func displayPane(textBuffer [][]rune, originX, originY, cols, rows, offsetX, offsetY int) {
 	var row, col int
 
-	for row = 0; row <= ROWS; row++ {
-		textBufferRow := row + OFFSETY
+	for row = 0; row <= rows; row++ {
+		textBufferRow := row + offsetY
 
-		DisplayLineNumber(row, textBufferRow)
+		DisplayLineNumber(originX, originY+row, textBufferRow, len(textBuffer))
 
-		for col = 0; col < COLS; col++ {
-			textBufferCol := col + OFFSETX
+		for col = 0; col < cols; col++ {
+			textBufferCol := col + offsetX
 
 			if textBufferRow >= 0 &&
-				textBufferRow < len(TEXTBUFFER) &&
-				textBufferCol < len(TEXTBUFFER[textBufferRow]) {
-				TERMINAL.SetContent(col+LINECOUNTWIDTH, row,
-					TEXTBUFFER[textBufferRow][textBufferCol],
+				textBufferRow < len(textBuffer) &&
+				textBufferCol < len(textBuffer[textBufferRow]) {
+				TERMINAL.SetContent(originX+col+LINECOUNTWIDTH, originY+row,
+					textBuffer[textBufferRow][textBufferCol],
 					nil, STYLES.MAINSTYLE)
 			}
 		}
 	}
 }
 
+// displaySeparators draws the lines between split panes
+func displaySeparators(node *PaneLayout) {
+	if node.Pane != nil {
+		return
+	}
+	first := collectPanes(node.First, nil)
+	last := first[len(first)-1]
+	if node.Vertical {
+		// The separator column sits right of the first half, for the full height of the split
+		x := last.X + last.Width
+		top := first[0].Y
+		for y := top; y < top+splitHeight(node); y++ {
+			TERMINAL.SetContent(x, y, '│', nil, STYLES.LINECOUNTSTYLE)
+		}
+	} else {
+		y := last.Y + last.Height
+		left := first[0].X
+		for x := left; x < left+splitWidth(node); x++ {
+			TERMINAL.SetContent(x, y, '─', nil, STYLES.LINECOUNTSTYLE)
+		}
+	}
+	displaySeparators(node.First)
+	displaySeparators(node.Second)
+}
+
+// splitWidth returns the number of columns a layout node covers
+func splitWidth(node *PaneLayout) int {
+	if node.Pane != nil {
+		return node.Pane.Width
+	}
+	if node.Vertical {
+		return splitWidth(node.First) + 1 + splitWidth(node.Second)
+	}
+	return splitWidth(node.First)
+}
+
+// splitHeight returns the number of rows a layout node covers
+func splitHeight(node *PaneLayout) int {
+	if node.Pane != nil {
+		return node.Pane.Height
+	}
+	if node.Vertical {
+		return splitHeight(node.First)
+	}
+	return splitHeight(node.First) + 1 + splitHeight(node.Second)
+}
+
 func DisplayStatus() {
 	var col int
+	// The status bar spans the whole screen, below every pane
+	statusRow := SCREENROWS - 1
+	statusCols := SCREENCOLS - LINECOUNTWIDTH
 
-	TERMINAL.SetContent(0, ROWS+1, ' ', nil, STYLES.STATUSSTYLE)
-	TERMINAL.SetContent(1, ROWS+1, '', nil, STYLES.STATUSSTYLE)
-	TERMINAL.SetContent(2, ROWS+1, '❯', nil, STYLES.STATUSSTYLE)
+	TERMINAL.SetContent(0, statusRow, ' ', nil, STYLES.STATUSSTYLE)
+	TERMINAL.SetContent(1, statusRow, '', nil, STYLES.STATUSSTYLE)
+	TERMINAL.SetContent(2, statusRow, '❯', nil, STYLES.STATUSSTYLE)
 
 	BufferOffset := 3
-	for col = BufferOffset; col < COLS+LINECOUNTWIDTH; col++ {
-		TERMINAL.SetContent(col, ROWS+1, ' ', nil, STYLES.STATUSSTYLE)
-		if col-BufferOffset < len(INPUTBUFFER) {
-			TERMINAL.SetContent(col, ROWS+1,
-				INPUTBUFFER[col-BufferOffset],
-				nil, STYLES.STATUSSTYLE)
+	for col = BufferOffset; col < statusCols+LINECOUNTWIDTH; col++ {
+		TERMINAL.SetContent(col, statusRow, ' ', nil, STYLES.STATUSSTYLE)
+	}
+	if len(KEYPENDING) > 0 {
+		PrintMessageStyle(BufferOffset, statusRow, STYLES.STATUSSTYLE, strings.Join(KEYPENDING, " ")+" ...")
+	} else if len(INPUTBUFFER.Text) == 0 {
+		PrintMessageStyle(BufferOffset, statusRow, STYLES.STATUSSTYLE, STATUSMESSAGE)
+	} else {
+		displayPromptInput(BufferOffset, statusRow, STYLES.STATUSSTYLE, INPUTBUFFER)
+	}
+	// Tab completion candidates are listed on the row above the status bar
+	if len(COMMANDCOMPLETIONS) > 0 {
+		for col := 0; col < SCREENCOLS; col++ {
+			TERMINAL.SetContent(col, statusRow-1, ' ', nil, STYLES.STATUSSTYLE)
 		}
+		PrintMessageStyle(BufferOffset, statusRow-1, STYLES.STATUSSTYLE, strings.Join(COMMANDCOMPLETIONS, "  "))
 	}
 
 	var currentLine = CURSORY + OFFSETY
@@ -68,27 +158,60 @@ func DisplayStatus() {
 	var currentColumn = CURSORX + OFFSETX - LINECOUNTWIDTH
 	var columnNumberStr = strconv.Itoa(currentColumn + 1)
 	// #TODO do the offsets more neat
-	PrintMessageStyle(COLS, ROWS+1, STYLES.STATUSSTYLE, columnNumberStr)
-	PrintMessageStyle(COLS-4, ROWS+1, STYLES.STATUSSTYLE, "col")
-	PrintMessageStyle(COLS-8, ROWS+1, STYLES.STATUSSTYLE, lineNumberStr)
-	PrintMessageStyle(COLS-12, ROWS+1, STYLES.STATUSSTYLE, "row")
+	PrintMessageStyle(statusCols, statusRow, STYLES.STATUSSTYLE, columnNumberStr)
+	PrintMessageStyle(statusCols-4, statusRow, STYLES.STATUSSTYLE, "col")
+	PrintMessageStyle(statusCols-8, statusRow, STYLES.STATUSSTYLE, lineNumberStr)
+	PrintMessageStyle(statusCols-12, statusRow, STYLES.STATUSSTYLE, "row")
+
+	// Indicators are drawn right to left, ending just before "row"
+	indicatorEnd := statusCols - 13
+	for _, indicator := range statusIndicators() {
+		indicatorEnd -= len([]rune(indicator)) + 1
+		PrintMessageStyle(indicatorEnd, statusRow, STYLES.STATUSSTYLE, indicator)
+	}
+}
+
+// statusIndicators returns the short state markers shown in the status bar, rightmost first
+func statusIndicators() []string {
+	var indicators []string
+	indicators = append(indicators, FILEFORMAT.LineEndingName())
+	if FILEFORMAT.BOM {
+		indicators = append(indicators, "BOM")
+	}
+	if len(BUFFERS) > 1 {
+		indicators = append(indicators, fmt.Sprintf("b%d/%d", CURRENTBUFFER+1, len(BUFFERS)))
+	}
+	if AUTOSAVEIDLE > 0 || AUTOSAVEONFOCUSLOST {
+		indicators = append(indicators, "AS:"+autosaveDescription())
+	}
+	if READONLY {
+		indicators = append(indicators, "RO")
+	}
+	if MODIFIED {
+		indicators = append(indicators, "[+]")
+	}
+	if VIM.Enabled {
+		indicators = append(indicators, vimModeIndicator())
+	}
+	return indicators
 }
 
-func DisplayLineNumber(row int, textBufferRow int) {
+// DisplayLineNumber draws the gutter entry for textBufferRow at a screen position
+func DisplayLineNumber(originX, screenRow int, textBufferRow int, lineCount int) {
 	lineNumberStr := "~"
 
-	if textBufferRow < len(TEXTBUFFER) {
+	if textBufferRow < lineCount {
 		lineNumberStr = strconv.Itoa(textBufferRow + 1)
 	}
 
 	lineNumberOffset := LINECOUNTWIDTH - len(lineNumberStr)
 	if lineNumberOffset > 0 {
 		for i := 0; i < lineNumberOffset; i++ {
-			TERMINAL.SetContent(i, row, ' ', nil, STYLES.LINECOUNTSTYLE)
+			TERMINAL.SetContent(originX+i, screenRow, ' ', nil, STYLES.LINECOUNTSTYLE)
 		}
 	}
 
-	PrintMessageStyle(lineNumberOffset, row, STYLES.LINECOUNTSTYLE, lineNumberStr)
+	PrintMessageStyle(originX+lineNumberOffset, screenRow, STYLES.LINECOUNTSTYLE, lineNumberStr)
 }
 
 func DisplaySettingsLoop(currentPos int) {
@@ -3,21 +3,134 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 )
 
-// WriteBufferToFile writes the textBuffer contents to the specified file
-func WriteBufferToFile(textBuffer [][]rune, filename string) error {
-	file, err := os.Create(filename)
+// FileFormat records how a file was laid out on disk, so saving it reproduces the same bytes around the text
+type FileFormat struct {
+	// LineEnding is either "\n" or "\r\n"
+	LineEnding   string `json:"line_ending"`
+	FinalNewline bool   `json:"final_newline"`
+	BOM          bool   `json:"bom"`
+}
+
+const utf8BOM = "\ufeff"
+
+// FILEFORMAT is the format of the active buffer
+var FILEFORMAT = DefaultFileFormat()
+
+// DefaultFileFormat returns the format used for buffers that were not read from a file
+func DefaultFileFormat() FileFormat {
+	return FileFormat{LineEnding: "\n", FinalNewline: true}
+}
+
+// LineEndingName returns the name shown for a format's line ending
+func (f FileFormat) LineEndingName() string {
+	if f.LineEnding == "\r\n" {
+		return "CRLF"
+	}
+	return "LF"
+}
+
+// WriteBufferToFile writes the textBuffer contents to the specified file in the given format.
+// On success it clears MODIFIED and records the written version in DISKSTATE.
+// The buffer is written to a temporary file next to the target which is then renamed over it,
+// so a failed save leaves the original file untouched. Symlinks are followed to the real file,
+// whose mode bits and, where permitted, ownership are kept. New files get the mode os.Create would give them.
+// When the directory can't take a temporary file, the file is written in place
+func WriteBufferToFile(textBuffer [][]rune, format FileFormat, filename string) error {
+	target := resolveSymlinks(filename)
+
+	mode := newFileMode()
+	info, statErr := os.Stat(target)
+	if statErr == nil {
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".ste-*")
+	if os.IsPermission(err) {
+		return writeInPlace(textBuffer, format, target)
+	}
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	tempName := file.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tempName)
+		}
+	}()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	if err := writeBuffer(file, textBuffer, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// The temporary file starts out private, so it gets the target's mode before taking its place
+	if err := os.Chmod(tempName, mode); err != nil {
+		return err
+	}
+	if statErr == nil {
+		copyOwnership(tempName, info)
+	}
+
+	if err := os.Rename(tempName, target); err != nil {
+		return err
+	}
+	renamed = true
+	syncDir(filepath.Dir(target))
+
+	MODIFIED = false
+	DISKSTATE = ReadDiskState(target)
+	return nil
+}
+
+// writeInPlace truncates and rewrites a file, for files that may be written in a directory that may not.
+// Unlike the rename in WriteBufferToFile, a failed write can leave the file cut short
+func writeInPlace(textBuffer [][]rune, format FileFormat, target string) error {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if err := writeBuffer(file, textBuffer, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	MODIFIED = false
+	DISKSTATE = ReadDiskState(target)
+	return nil
+}
+
+// writeBuffer writes the textBuffer contents to file in the given format
+func writeBuffer(output io.Writer, textBuffer [][]rune, format FileFormat) error {
+	writer := bufio.NewWriter(output)
+
+	if format.BOM {
+		if _, err := writer.WriteString(utf8BOM); err != nil {
+			return err
+		}
+	}
 
 	for i, line := range textBuffer {
 		lineStr := string(line)
@@ -26,15 +139,38 @@ func WriteBufferToFile(textBuffer [][]rune, filename string) error {
 			return err
 		}
 
-		if i < len(textBuffer)-1 {
-			_, err := writer.WriteString("\n")
+		// The last line only gets a line ending if the file had one
+		if i < len(textBuffer)-1 || format.FinalNewline {
+			_, err := writer.WriteString(format.LineEnding)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	return writer.Flush()
+}
+
+// resolveSymlinks follows filename through any symlinks to the file they point at.
+// Unlike filepath.EvalSymlinks this also resolves links whose target doesn't exist yet
+func resolveSymlinks(filename string) string {
+	path := filename
+	// Same limit as the kernel, so a symlink loop can't hang the save
+	for i := 0; i < 40; i++ {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return path
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return path
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return path
 }
 
 // SaveCurrentState saves the current textBuffer to the sourceFile
@@ -44,42 +180,85 @@ func SaveCurrentState() (string, error) {
 		// No file name set, caller should handle save-as
 		return "", fmt.Errorf("no filename set")
 	} else {
+		if READONLY && ChoiceLoop(BufferName(BUFFERS[CURRENTBUFFER])+" is read-only!", []string{"write anyway", "cancel"}) != 0 {
+			return SOURCEFILE, fmt.Errorf("save cancelled")
+		}
+		// Something else may have changed the file since it was read
+		if !confirmExternalOverwrite() {
+			return SOURCEFILE, fmt.Errorf("save cancelled")
+		}
 		// Save to existing file
-		err := WriteBufferToFile(TEXTBUFFER, SOURCEFILE)
+		err := WriteBufferToFile(TEXTBUFFER, FILEFORMAT, SOURCEFILE)
 		if err != nil {
 			// Display error message to user
-			PrintMessage(0, ROWS, tcell.ColorRed, tcell.ColorDefault,
+			PrintMessage(0, SCREENROWS-2, tcell.ColorRed, tcell.ColorDefault,
 				fmt.Sprintf("Error saving file: %s", err.Error()))
 			TERMINAL.Show()
-			TERMINAL.PollEvent()
+			WaitForKey()
 			return SOURCEFILE, err
 		}
 		return SOURCEFILE, nil
 	}
 }
 
-// OpenFile opens a specific file and reads it into a text buffer
-func OpenFile(filename string) ([][]rune, error) {
-	textBuffer := [][]rune{}
+// OpenFile opens a specific file and reads it into a text buffer.
+// The returned FileFormat records the line endings, final newline and BOM found in the file.
+// Lines of any length are read, and a failed read returns an error rather than part of the file
+func OpenFile(filename string) ([][]rune, FileFormat, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		// Return empty buffer if file doesn't exist
-		return append(textBuffer, []rune{}), err
+		return [][]rune{{}}, DefaultFileFormat(), err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	lineNumber := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		textBuffer = append(textBuffer, []rune{})
-		for _, ch := range line {
-			textBuffer[lineNumber] = append(textBuffer[lineNumber], rune(ch))
+	return ReadBuffer(file)
+}
+
+// ReadBuffer reads text into a buffer, detecting its line endings, final newline and BOM.
+// OpenFile reads files through it, and piped input is read from stdin with it
+func ReadBuffer(input io.Reader) ([][]rune, FileFormat, error) {
+	textBuffer := [][]rune{}
+	format := DefaultFileFormat()
+	reader := bufio.NewReader(input)
+	crlfCount, lfCount := 0, 0
+	format.FinalNewline = false
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if len(textBuffer) == 0 && strings.HasPrefix(line, utf8BOM) {
+				format.BOM = true
+				line = strings.TrimPrefix(line, utf8BOM)
+			}
+
+			// Every line but the last has a line ending, so FinalNewline ends up describing the last one
+			format.FinalNewline = false
+			if strings.HasSuffix(line, "\r\n") {
+				crlfCount++
+				format.FinalNewline = true
+				line = strings.TrimSuffix(line, "\r\n")
+			} else if strings.HasSuffix(line, "\n") {
+				lfCount++
+				format.FinalNewline = true
+				line = strings.TrimSuffix(line, "\n")
+			}
+
+			textBuffer = append(textBuffer, []rune(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return [][]rune{{}}, DefaultFileFormat(), fmt.Errorf("failed to read file: %w", err)
 		}
-		lineNumber++
 	}
-	if lineNumber == 0 {
+	if len(textBuffer) == 0 {
 		textBuffer = append(textBuffer, []rune{})
 	}
-	return textBuffer, nil
+
+	// Mixed files are saved with whichever line ending they use most
+	if crlfCount > lfCount {
+		format.LineEnding = "\r\n"
+	}
+	return textBuffer, format, nil
 }
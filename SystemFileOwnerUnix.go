@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyOwnership gives path the owner and group in info.
+// Only root may give files away, so failures are ignored and the file keeps the saving user as owner
+func copyOwnership(path string, info os.FileInfo) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		os.Chown(path, int(stat.Uid), int(stat.Gid))
+	}
+}
+
+// UMASK is the process umask. It is read once at startup, before any goroutine runs,
+// since reading it means briefly setting it for the whole process
+var UMASK = readUmask()
+
+// readUmask returns the process umask. It can only be read by setting it, so it is put straight back
+func readUmask() int {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return mask
+}
+
+// newFileMode returns the mode os.Create gives a new file, 0666 less the process umask
+func newFileMode() os.FileMode {
+	return os.FileMode(0666 &^ UMASK)
+}
+
+// syncDir flushes changes to a directory's entries, like a rename, to disk
+func syncDir(dir string) {
+	directory, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer directory.Close()
+	directory.Sync()
+}
+
+// fileWritable reports whether a file may be written to. Files that don't exist yet count as writable.
+// The permission is asked for rather than tried, since opening a FIFO or a device to find out has effects of its own.
+// Any other failure, like a read-only file system, counts as not writable
+func fileWritable(filename string) bool {
+	err := unix.Access(filename, unix.W_OK)
+	return err == nil || err == unix.ENOENT
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// copyOwnership does nothing on Windows, where new files inherit their permissions from the directory
+func copyOwnership(path string, info os.FileInfo) {}
+
+// newFileMode returns the mode os.Create gives a new file. Windows has no umask
+func newFileMode() os.FileMode {
+	return 0666
+}
+
+// syncDir does nothing on Windows, which can't open directories for syncing
+func syncDir(dir string) {}
+
+// fileWritable reports whether a file may be written to, which on Windows is whether it lacks the read-only attribute.
+// Files that don't exist yet count as writable
+func fileWritable(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return true
+	}
+	return info.Mode().Perm()&0200 != 0
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// EventWalk is posted while a FileWalk finds files, so the file finder can show them as they come in
+type EventWalk struct {
+	tcell.EventTime
+}
+
+// MAXWALKFILES stops a walk of a huge tree, WALKBATCH is how many files are found between EventWalks
+const MAXWALKFILES = 200000
+const WALKBATCH = 500
+
+var errWalkStopped = errors.New("file walk stopped")
+
+// FileWalk lists the files below a directory in the background, skipping .git and anything .gitignore ignores
+type FileWalk struct {
+	mu     sync.Mutex
+	files  []string
+	done   bool
+	cancel chan struct{}
+	once   sync.Once
+}
+
+// StartFileWalk starts listing the files below root. Paths are relative to root
+func StartFileWalk(root string) *FileWalk {
+	walk := &FileWalk{cancel: make(chan struct{})}
+	go walk.run(root)
+	return walk
+}
+
+// Files returns the files found so far, and whether the walk has finished
+func (walk *FileWalk) Files() ([]string, bool) {
+	walk.mu.Lock()
+	defer walk.mu.Unlock()
+	// Files are only ever appended, so the caller can keep this slice while the walk goes on
+	return walk.files[:len(walk.files):len(walk.files)], walk.done
+}
+
+// Cancel stops the walk, the files found so far stay available
+func (walk *FileWalk) Cancel() {
+	walk.once.Do(func() { close(walk.cancel) })
+}
+
+func (walk *FileWalk) run(root string) {
+	var rules IgnoreRules
+	var batch []string
+	found := 0
+
+	flush := func(done bool) {
+		walk.mu.Lock()
+		walk.files = append(walk.files, batch...)
+		walk.done = done
+		walk.mu.Unlock()
+		batch = batch[:0]
+		event := &EventWalk{}
+		event.SetEventNow()
+		TERMINAL.PostEvent(event)
+	}
+
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		select {
+		case <-walk.cancel:
+			return errWalkStopped
+		default:
+		}
+		if err != nil {
+			// Unreadable directories are left out, the rest of the tree is still listed
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if rel == "." {
+			rules = append(rules, readIgnoreFile(path, "")...)
+			return nil
+		}
+		slashRel := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" || rules.Ignored(slashRel, true) {
+				return filepath.SkipDir
+			}
+			rules = append(rules, readIgnoreFile(path, slashRel)...)
+			return nil
+		}
+		// Lock files of open files are STE's own
+		if strings.HasSuffix(entry.Name(), ".ste-lock") || rules.Ignored(slashRel, false) {
+			return nil
+		}
+
+		batch = append(batch, rel)
+		found++
+		if found >= MAXWALKFILES {
+			return errWalkStopped
+		}
+		if len(batch) >= WALKBATCH {
+			flush(false)
+		}
+		return nil
+	})
+
+	flush(true)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+)
+
+// FuzzyResult is a candidate that matched a fuzzy pattern, with the rune positions of the matched characters
+type FuzzyResult struct {
+	Text      string
+	Score     int
+	Positions []int
+}
+
+// Scores given per matched character by FuzzyMatch
+const (
+	fuzzyMatchScore       = 16
+	fuzzyBoundaryBonus    = 8
+	fuzzyPathBonus        = 10
+	fuzzyCamelBonus       = 7
+	fuzzyConsecutiveBonus = 6
+	fuzzyExactCaseBonus   = 1
+	fuzzyGapPenalty       = 1
+	fuzzyMaxGapPenalty    = 8
+)
+
+// FuzzyMatch checks that every character of pattern appears in candidate in order, ignoring case.
+// Matches score higher when they are consecutive, start words or path components, and sit close together.
+// Returns false if candidate doesn't match
+func FuzzyMatch(pattern, candidate string) (int, []int, bool) {
+	needle := []rune(pattern)
+	text := []rune(candidate)
+	if len(needle) == 0 {
+		return 0, nil, true
+	}
+
+	// The first match found going forwards fixes where the match can end,
+	// going backwards from there finds the tightest match ending at that point
+	end := -1
+	for i, n := 0, 0; i < len(text); i++ {
+		if unicode.ToLower(text[i]) == unicode.ToLower(needle[n]) {
+			n++
+			if n == len(needle) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions := make([]int, len(needle))
+	for i, n := end, len(needle)-1; n >= 0; i-- {
+		if unicode.ToLower(text[i]) == unicode.ToLower(needle[n]) {
+			positions[n] = i
+			n--
+		}
+	}
+
+	score := 0
+	for n, position := range positions {
+		score += fuzzyMatchScore + fuzzyBonus(text, position)
+		if text[position] == needle[n] {
+			score += fuzzyExactCaseBonus
+		}
+		if n > 0 {
+			gap := position - positions[n-1] - 1
+			if gap == 0 {
+				score += fuzzyConsecutiveBonus
+			} else {
+				penalty := gap * fuzzyGapPenalty
+				if penalty > fuzzyMaxGapPenalty {
+					penalty = fuzzyMaxGapPenalty
+				}
+				score -= penalty
+			}
+		}
+	}
+	return score, positions, true
+}
+
+// fuzzyBonus scores where a matched character sits: right after a path separator, at the start of a word or camelCase hump
+func fuzzyBonus(text []rune, position int) int {
+	if position == 0 {
+		return fuzzyPathBonus
+	}
+	previous, current := text[position-1], text[position]
+	switch {
+	case previous == '/' || previous == '\\':
+		return fuzzyPathBonus
+	case previous == '_' || previous == '-' || previous == '.' || previous == ' ':
+		return fuzzyBoundaryBonus
+	case unicode.IsLower(previous) && unicode.IsUpper(current):
+		return fuzzyCamelBonus
+	}
+	return 0
+}
+
+// FuzzyRank matches pattern against every candidate and returns the matches, best first.
+// Equal scores go to the shorter candidate, an empty pattern keeps the candidates in their order
+func FuzzyRank(pattern string, candidates []string) []FuzzyResult {
+	results := make([]FuzzyResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		if score, positions, ok := FuzzyMatch(pattern, candidate); ok {
+			results = append(results, FuzzyResult{Text: candidate, Score: score, Positions: positions})
+		}
+	}
+	if pattern == "" {
+		return results
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return len(results[i].Text) < len(results[j].Text)
+	})
+	return results
+}
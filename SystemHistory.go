@@ -0,0 +1,237 @@
+package main
+
+// EditKind identifies which primitive buffer mutation an Edit records
+type EditKind int
+
+const (
+	EditInsertRune EditKind = iota
+	EditDeleteRune
+	EditSplitLine
+	EditJoinLine
+)
+
+// MAXHISTORY caps how many undo steps are kept for a buffer
+const MAXHISTORY = 1000
+
+// BufferPos is a position in TEXTBUFFER, independent of scrolling and the line number gutter
+type BufferPos struct {
+	Line int
+	Col  int
+}
+
+// Edit is a single primitive mutation of TEXTBUFFER.
+// Before and After are the cursor positions around the edit, used to restore the cursor on undo/redo
+type Edit struct {
+	Kind   EditKind
+	Line   int
+	Col    int
+	Char   rune
+	Before BufferPos
+	After  BufferPos
+}
+
+// UndoStep is a group of edits that are undone and redone together
+type UndoStep []Edit
+
+// EditHistory holds the undo and redo stacks for a buffer
+type EditHistory struct {
+	UndoStack []UndoStep
+	RedoStack []UndoStep
+	// Changes counts every mutation of the buffer, including undo and redo,
+	// so anything mirroring the buffer can tell whether it changed since it last looked
+	Changes int
+	// open is true while the newest undo step may still absorb typed runes
+	open bool
+	// grouping is true between BeginStep and EndStep, and grouped once the group has its undo step
+	grouping bool
+	grouped  bool
+}
+
+var HISTORY = &EditHistory{}
+
+// Record adds an edit to the history and clears the redo stack.
+// Runes typed one after another on the same line are merged into a single undo step
+func (h *EditHistory) Record(edit Edit) {
+	h.RedoStack = nil
+
+	if h.grouping && h.grouped && len(h.UndoStack) > 0 {
+		h.UndoStack[len(h.UndoStack)-1] = append(h.UndoStack[len(h.UndoStack)-1], edit)
+		return
+	}
+	h.grouped = h.grouping
+
+	if h.open && edit.Kind == EditInsertRune && len(h.UndoStack) > 0 {
+		last := h.UndoStack[len(h.UndoStack)-1]
+		prev := last[len(last)-1]
+		if prev.Kind == EditInsertRune && prev.Line == edit.Line && prev.Col+1 == edit.Col {
+			h.UndoStack[len(h.UndoStack)-1] = append(last, edit)
+			return
+		}
+	}
+
+	h.UndoStack = append(h.UndoStack, UndoStep{edit})
+	if len(h.UndoStack) > MAXHISTORY {
+		h.UndoStack = h.UndoStack[len(h.UndoStack)-MAXHISTORY:]
+	}
+	h.open = edit.Kind == EditInsertRune
+}
+
+// BreakGroup ends the current typing group, so the next edit starts a new undo step
+func (h *EditHistory) BreakGroup() {
+	h.open = false
+}
+
+// BeginStep starts a group of edits that are undone and redone together, like a vim change with the text typed for it
+func (h *EditHistory) BeginStep() {
+	h.grouping = true
+	h.grouped = false
+}
+
+// EndStep ends the group started by BeginStep
+func (h *EditHistory) EndStep() {
+	h.grouping = false
+	h.grouped = false
+	h.open = false
+}
+
+// Reset forgets all undo and redo steps, used when the buffer is replaced
+func (h *EditHistory) Reset() {
+	h.UndoStack = nil
+	h.RedoStack = nil
+	h.open = false
+	h.grouped = false
+}
+
+// Undo reverts the newest undo step and moves the cursor back to where it was before it.
+// Returns false if there is nothing to undo
+func Undo() bool {
+	if len(HISTORY.UndoStack) == 0 || refuseReadOnly() {
+		return false
+	}
+	step := HISTORY.UndoStack[len(HISTORY.UndoStack)-1]
+	HISTORY.UndoStack = HISTORY.UndoStack[:len(HISTORY.UndoStack)-1]
+
+	for i := len(step) - 1; i >= 0; i-- {
+		applyEdit(step[i], true)
+	}
+	HISTORY.RedoStack = append(HISTORY.RedoStack, step)
+	HISTORY.open = false
+	HISTORY.grouped = false
+
+	MoveCursorTo(step[0].Before.Line, step[0].Before.Col)
+	return true
+}
+
+// Redo reapplies the newest undone step and moves the cursor to where it was after it.
+// Returns false if there is nothing to redo
+func Redo() bool {
+	if len(HISTORY.RedoStack) == 0 || refuseReadOnly() {
+		return false
+	}
+	step := HISTORY.RedoStack[len(HISTORY.RedoStack)-1]
+	HISTORY.RedoStack = HISTORY.RedoStack[:len(HISTORY.RedoStack)-1]
+
+	for _, edit := range step {
+		applyEdit(edit, false)
+	}
+	HISTORY.UndoStack = append(HISTORY.UndoStack, step)
+	HISTORY.open = false
+	HISTORY.grouped = false
+
+	last := step[len(step)-1]
+	MoveCursorTo(last.After.Line, last.After.Col)
+	return true
+}
+
+// applyEdit performs an edit on TEXTBUFFER, or its opposite when inverse is set
+func applyEdit(edit Edit, inverse bool) {
+	kind := edit.Kind
+	if inverse {
+		switch kind {
+		case EditInsertRune:
+			kind = EditDeleteRune
+		case EditDeleteRune:
+			kind = EditInsertRune
+		case EditSplitLine:
+			kind = EditJoinLine
+		case EditJoinLine:
+			kind = EditSplitLine
+		}
+	}
+
+	switch kind {
+	case EditInsertRune:
+		bufferInsertRune(edit.Line, edit.Col, edit.Char)
+	case EditDeleteRune:
+		bufferDeleteRune(edit.Line, edit.Col)
+	case EditSplitLine:
+		bufferSplitLine(edit.Line, edit.Col)
+	case EditJoinLine:
+		bufferJoinLine(edit.Line)
+	}
+}
+
+// markChanged flags the active buffer as modified, called by every primitive mutation
+func markChanged() {
+	MODIFIED = true
+	HISTORY.Changes++
+}
+
+// bufferInsertRune inserts a rune into TEXTBUFFER at the given position
+func bufferInsertRune(line, col int, r rune) {
+	markChanged()
+	old := TEXTBUFFER[line]
+	newLine := make([]rune, len(old)+1)
+	copy(newLine, old[:col])
+	newLine[col] = r
+	copy(newLine[col+1:], old[col:])
+	TEXTBUFFER[line] = newLine
+}
+
+// bufferDeleteRune removes the rune at the given position and returns it
+func bufferDeleteRune(line, col int) rune {
+	markChanged()
+	old := TEXTBUFFER[line]
+	r := old[col]
+	newLine := make([]rune, len(old)-1)
+	copy(newLine, old[:col])
+	copy(newLine[col:], old[col+1:])
+	TEXTBUFFER[line] = newLine
+	return r
+}
+
+// bufferSplitLine breaks a line in two at col, moving the rest of it to a new line below
+func bufferSplitLine(line, col int) {
+	markChanged()
+	currentLine := TEXTBUFFER[line]
+	beforeCursor := make([]rune, col)
+	copy(beforeCursor, currentLine[:col])
+
+	afterCursor := make([]rune, len(currentLine)-col)
+	copy(afterCursor, currentLine[col:])
+
+	newTEXTBUFFER := make([][]rune, len(TEXTBUFFER)+1)
+	copy(newTEXTBUFFER[:line], TEXTBUFFER[:line])
+	newTEXTBUFFER[line] = beforeCursor
+	newTEXTBUFFER[line+1] = afterCursor
+	copy(newTEXTBUFFER[line+2:], TEXTBUFFER[line+1:])
+	TEXTBUFFER = newTEXTBUFFER
+}
+
+// bufferJoinLine appends the line below onto the given line and removes it.
+// Returns the column where the two lines were joined
+func bufferJoinLine(line int) int {
+	markChanged()
+	joinCol := len(TEXTBUFFER[line])
+
+	joined := make([]rune, 0, joinCol+len(TEXTBUFFER[line+1]))
+	joined = append(joined, TEXTBUFFER[line]...)
+	joined = append(joined, TEXTBUFFER[line+1]...)
+
+	newTEXTBUFFER := make([][]rune, len(TEXTBUFFER)-1)
+	copy(newTEXTBUFFER[:line], TEXTBUFFER[:line])
+	newTEXTBUFFER[line] = joined
+	copy(newTEXTBUFFER[line+1:], TEXTBUFFER[line+2:])
+	TEXTBUFFER = newTEXTBUFFER
+	return joinCol
+}
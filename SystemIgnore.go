@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreRule is one pattern of a .gitignore file
+type IgnoreRule struct {
+	// Base is the directory of the .gitignore, relative to the walk root with "/" separators, "" for the root
+	Base string
+	// Segments is the pattern split on "/", where "**" matches any number of directories
+	Segments []string
+	// Anchored patterns contain a "/" and match from Base, the others match a name at any depth
+	Anchored bool
+	DirOnly  bool
+	Negate   bool
+}
+
+// IgnoreRules are the rules of every .gitignore seen so far. The last rule matching a path decides
+type IgnoreRules []IgnoreRule
+
+// ParseIgnoreFile reads the rules of a .gitignore in the directory base
+func ParseIgnoreFile(base, content string) IgnoreRules {
+	var rules IgnoreRules
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := IgnoreRule{Base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.Negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.DirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.Anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.Segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// readIgnoreFile reads the .gitignore in dir if there is one, base is dir relative to the walk root
+func readIgnoreFile(dir, base string) IgnoreRules {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	return ParseIgnoreFile(base, string(data))
+}
+
+// Ignored reports whether a path relative to the walk root, with "/" separators, is ignored
+func (rules IgnoreRules) Ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		rel := relPath
+		if rule.Base != "" {
+			if !strings.HasPrefix(relPath, rule.Base+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(relPath, rule.Base+"/")
+		}
+
+		var matched bool
+		if rule.Anchored {
+			matched = matchSegments(rule.Segments, strings.Split(rel, "/"))
+		} else {
+			matched, _ = path.Match(rule.Segments[0], path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.Negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches path segments against pattern segments, with "**" standing for any number of segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
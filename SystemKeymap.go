@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Keymap maps key sequences to the status bar commands they run. A sequence is one or more keys
+// separated by spaces, like "Ctrl-K Ctrl-S", where each key is written the way KeyName writes it
+type Keymap map[string]string
+
+// KeySettings are the key bindings in config.json, added to the default ones. Binding a key to "" unbinds it
+type KeySettings struct {
+	Command map[string]string `json:"command"`
+	Write   map[string]string `json:"write"`
+}
+
+// DEFAULTCOMMANDKEYS and DEFAULTWRITEKEYS are the bindings in command mode and in WriteLoop before config.json is applied
+var DEFAULTCOMMANDKEYS = Keymap{
+	"Ctrl-T":        "sidebar",
+	"Ctrl-O":        "focus",
+	"Alt-X":         "palette",
+	"Ctrl-K Ctrl-S": "save",
+}
+var DEFAULTWRITEKEYS = Keymap{
+	"Ctrl-Z":        "undo",
+	"Ctrl-Y":        "redo",
+	"Ctrl-T":        "sidebar",
+	"Ctrl-O":        "focus",
+	"Alt-X":         "palette",
+	"Ctrl-K Ctrl-S": "save",
+}
+
+// COMMANDKEYS and WRITEKEYS are the bindings in use in command mode and in WriteLoop
+var COMMANDKEYS = Keymap{}
+var WRITEKEYS = Keymap{}
+
+// KEYPENDING holds the keys of a chord typed so far, while the rest of it is waited for
+var KEYPENDING []string
+
+// keyModifiers are the modifier names a key can start with, in the order KeyName writes them
+var keyModifiers = []struct {
+	Name  string
+	Mask  tcell.ModMask
+	Alias []string
+}{
+	{"Ctrl", tcell.ModCtrl, []string{"ctrl", "c", "control"}},
+	{"Alt", tcell.ModAlt, []string{"alt", "a", "m", "meta"}},
+	{"Shift", tcell.ModShift, []string{"shift", "s"}},
+}
+
+// ctrlAliases are the Ctrl keys terminals send as the same byte as another key, so they can't be bound apart from it
+var ctrlAliases = map[string]string{"I": "Tab", "M": "Enter", "H": "Backspace", "[": "Esc"}
+
+// KeyName writes a key press the way keymaps name it, like "Ctrl-K", "Alt-X" or "Shift-F5".
+// Letters are always upper case. Returns "" for plain typing, which can't be bound
+func KeyName(ev *tcell.EventKey) string {
+	mod := ev.Modifiers()
+	var base string
+	if ev.Key() == tcell.KeyRune {
+		if mod&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+			return ""
+		}
+		// Shifted runes already differ from unshifted ones
+		mod &^= tcell.ModShift
+		base = strings.ToUpper(string(ev.Rune()))
+		if base == " " {
+			base = "Space"
+		}
+	} else {
+		name, ok := tcell.KeyNames[ev.Key()]
+		if !ok {
+			return ""
+		}
+		if strings.HasPrefix(name, "Ctrl-") {
+			// Like shifted runes, Ctrl and a letter reads the same with Shift held, as parseKey writes it
+			mod = (mod | tcell.ModCtrl) &^ tcell.ModShift
+			name = strings.TrimPrefix(name, "Ctrl-")
+		}
+		base = name
+	}
+	return modifierPrefix(mod) + base
+}
+
+// modifierPrefix writes the modifiers of a key, like "Ctrl-Alt-"
+func modifierPrefix(mod tcell.ModMask) string {
+	prefix := ""
+	for _, modifier := range keyModifiers {
+		if mod&modifier.Mask != 0 {
+			prefix += modifier.Name + "-"
+		}
+	}
+	return prefix
+}
+
+// ParseKeySequence reads a key sequence from config.json, accepting any case and short modifiers like "C-k",
+// and writes it the way KeyName does
+func ParseKeySequence(sequence string) (string, error) {
+	var keys []string
+	for _, key := range strings.Fields(sequence) {
+		parsed, err := parseKey(key)
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, parsed)
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("failed to parse key: no key given")
+	}
+	return strings.Join(keys, " "), nil
+}
+
+// parseKey reads a single key of a sequence
+func parseKey(key string) (string, error) {
+	var mod tcell.ModMask
+	rest := key
+	for {
+		dash := strings.Index(rest, "-")
+		// A dash at the end is the key itself, as in "Alt--"
+		if dash <= 0 || dash == len(rest)-1 {
+			break
+		}
+		found := false
+		for _, modifier := range keyModifiers {
+			for _, alias := range modifier.Alias {
+				if strings.EqualFold(rest[:dash], alias) {
+					mod |= modifier.Mask
+					found = true
+				}
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("failed to parse key %q: unknown modifier %q", key, rest[:dash])
+		}
+		rest = rest[dash+1:]
+	}
+
+	if utf8.RuneCountInString(rest) == 1 || strings.EqualFold(rest, "Space") {
+		if mod&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+			return "", fmt.Errorf("failed to parse key %q: typing can only be bound with Ctrl or Alt", key)
+		}
+		base := strings.ToUpper(rest)
+		if strings.EqualFold(rest, "Space") || rest == " " {
+			base = "Space"
+		}
+		if alias, ok := ctrlAliases[base]; ok && mod&tcell.ModCtrl != 0 {
+			return "", fmt.Errorf("failed to parse key %q: terminals send it as %s", key, alias)
+		}
+		// Ctrl and a letter is a key of its own, which KeyName writes the same way
+		return modifierPrefix(mod&^tcell.ModShift) + base, nil
+	}
+	for _, name := range tcell.KeyNames {
+		if strings.EqualFold(rest, name) && !strings.HasPrefix(name, "Ctrl-") {
+			return modifierPrefix(mod) + name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to parse key %q: unknown key %q", key, rest)
+}
+
+// applyKeymaps sets COMMANDKEYS and WRITEKEYS to the defaults with the bindings from config.json on top.
+// Keys that can't be read are skipped and reported in the status bar
+func applyKeymaps(keys KeySettings) {
+	var problems []string
+	COMMANDKEYS = mergeKeymap(DEFAULTCOMMANDKEYS, keys.Command, &problems)
+	WRITEKEYS = mergeKeymap(DEFAULTWRITEKEYS, keys.Write, &problems)
+	if len(problems) > 0 {
+		STATUSMESSAGE = "Key bindings in config.json: " + strings.Join(problems, "; ")
+	}
+}
+
+// mergeKeymap copies a default keymap and applies configured bindings to it
+func mergeKeymap(defaults Keymap, configured map[string]string, problems *[]string) Keymap {
+	keymap := Keymap{}
+	for sequence, command := range defaults {
+		keymap[sequence] = command
+	}
+	for sequence, command := range configured {
+		parsed, err := ParseKeySequence(sequence)
+		if err != nil {
+			*problems = append(*problems, err.Error())
+			continue
+		}
+		if command == "" {
+			delete(keymap, parsed)
+		} else {
+			keymap[parsed] = command
+		}
+	}
+	return keymap
+}
+
+// HandleKeymap looks a key press up in a keymap, carrying on with a chord that was started.
+// Returns true if the keymap took the key, running the bound command once a sequence is complete
+func HandleKeymap(keymap Keymap, ev *tcell.EventKey) bool {
+	name := KeyName(ev)
+	if name == "" && len(KEYPENDING) == 0 {
+		return false
+	}
+	sequence := strings.Join(append(append([]string{}, KEYPENDING...), name), " ")
+	if command, ok := keymap[sequence]; ok && name != "" {
+		KEYPENDING = nil
+		runCommand(command)
+		return true
+	}
+	if name != "" && keymap.isPrefix(sequence) {
+		KEYPENDING = append(KEYPENDING, name)
+		return true
+	}
+	if len(KEYPENDING) > 0 {
+		// A chord that goes nowhere swallows its last key, rather than typing it
+		STATUSMESSAGE = fmt.Sprintf("%s isn't bound", strings.TrimSpace(sequence))
+		KEYPENDING = nil
+		return true
+	}
+	return false
+}
+
+// isPrefix reports whether a sequence starts a longer binding of the keymap
+func (keymap Keymap) isPrefix(sequence string) bool {
+	for bound := range keymap {
+		if strings.HasPrefix(bound, sequence+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Sequences returns the bound key sequences, sorted
+func (keymap Keymap) Sequences() []string {
+	var sequences []string
+	for sequence := range keymap {
+		sequences = append(sequences, sequence)
+	}
+	sort.Strings(sequences)
+	return sequences
+}
+
+// KeysFor describes the keys that run a command, like "Ctrl-Z (write)", for the palette
+func KeysFor(command string) string {
+	var keys []string
+	for _, sequence := range COMMANDKEYS.Sequences() {
+		if COMMANDKEYS[sequence] == command {
+			keys = append(keys, sequence)
+		}
+	}
+	for _, sequence := range WRITEKEYS.Sequences() {
+		if WRITEKEYS[sequence] == command && !containsString(keys, sequence) {
+			keys = append(keys, sequence+" (write)")
+		}
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockFile is the advisory lock kept next to a file while it is open in STE,
+// so a second instance opening the same file knows who is editing it
+type LockFile struct {
+	PID  int       `json:"pid"`
+	Host string    `json:"host"`
+	Time time.Time `json:"time"`
+}
+
+// lockPathFor returns the lock file of a file, a hidden file next to it like .notes.txt.ste-lock
+func lockPathFor(filename string) string {
+	if path, err := filepath.Abs(filename); err == nil {
+		filename = path
+	}
+	dir, name := filepath.Split(filename)
+	return filepath.Join(dir, "."+name+".ste-lock")
+}
+
+// hostName returns the name of this machine, or "" if it can't be found
+func hostName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// readLock reads a lock file, returning false if there is none or it can't be read
+func readLock(lockPath string) (LockFile, bool) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return LockFile{}, false
+	}
+	var lock LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return LockFile{}, false
+	}
+	return lock, true
+}
+
+// ownsLock reports whether a lock was taken by this instance
+func ownsLock(lock LockFile) bool {
+	return lock.PID == os.Getpid() && lock.Host == hostName()
+}
+
+// lockStale reports whether a lock was left behind by an STE on this machine that is no longer running.
+// Locks from other machines can't be checked, so they are never stale
+func lockStale(lock LockFile) bool {
+	return lock.Host == hostName() && !processAlive(lock.PID)
+}
+
+// writeLock creates the lock file for a file, failing if one already exists
+func writeLock(lockPath string) error {
+	data, err := json.Marshal(LockFile{PID: os.Getpid(), Host: hostName(), Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	return file.Close()
+}
+
+// takeLock locks a file for this instance. Stale locks are replaced.
+// Returns the lock held by another running STE if there is one, with false.
+// Files whose directory can't hold a lock are opened without one
+func takeLock(filename string) (string, LockFile, bool) {
+	lockPath := lockPathFor(filename)
+	for attempt := 0; attempt < 2; attempt++ {
+		err := writeLock(lockPath)
+		if err == nil {
+			return lockPath, LockFile{}, true
+		}
+		if !os.IsExist(err) {
+			return "", LockFile{}, true
+		}
+		lock, ok := readLock(lockPath)
+		if ok && ownsLock(lock) {
+			return lockPath, LockFile{}, true
+		}
+		if ok && !lockStale(lock) {
+			return "", lock, false
+		}
+		// The STE that left it is gone, or it is unreadable, so it is taken over
+		os.Remove(lockPath)
+	}
+	return "", LockFile{}, true
+}
+
+// acquireLock locks a file that is about to be opened. If another running STE has it locked,
+// the user picks between opening it read-only, editing it anyway or not opening it.
+// Returns the lock path taken, "" if none, whether the buffer should be read-only, and false to abort
+func acquireLock(filename string) (string, bool, bool) {
+	lockPath, lock, ok := takeLock(filename)
+	if ok {
+		return lockPath, false, true
+	}
+
+	message := fmt.Sprintf("%s is being edited by pid %d on %s since %s!",
+		filepath.Base(filename), lock.PID, lock.Host, lock.Time.Format("2006-01-02 15:04"))
+	switch ChoiceLoop(message, []string{"read-only", "edit anyway", "abort"}) {
+	case 0:
+		return "", true, true
+	case 1:
+		return "", false, true
+	default:
+		return "", false, false
+	}
+}
+
+// releaseLock removes a buffer's lock file, as long as it is still the one this instance took
+func releaseLock(buffer *Buffer) {
+	if buffer.lockPath == "" {
+		return
+	}
+	if lock, ok := readLock(buffer.lockPath); ok && ownsLock(lock) {
+		os.Remove(buffer.lockPath)
+	}
+	buffer.lockPath = ""
+}
+
+// relockBuffer moves a buffer's lock to the file it was saved as.
+// Nobody is asked here, if another STE has the new file locked the buffer just goes without a lock
+func relockBuffer(buffer *Buffer, filename string) {
+	releaseLock(buffer)
+	if lockPath, _, ok := takeLock(filename); ok {
+		buffer.lockPath = lockPath
+	}
+}
+
+// ReleaseAllLocks removes the lock files of every open buffer, used when STE exits
+func ReleaseAllLocks() {
+	for _, buffer := range BUFFERS {
+		releaseLock(buffer)
+	}
+}
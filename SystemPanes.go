@@ -0,0 +1,206 @@
+package main
+
+// Pane is a viewport onto a buffer.
+// Like buffers, the active pane lives in the globals (CURSORX, OFFSETX, COLS, ROWS...)
+// and is only copied back into its Pane when another pane gets focus
+type Pane struct {
+	Buffer *Buffer
+	// CursorX is relative to the text area, so it does not depend on LINECOUNTWIDTH
+	CursorX int
+	CursorY int
+	OffsetX int
+	OffsetY int
+	// Screen rectangle of the pane including its gutter, set by LayoutPanes
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// PaneLayout is a node in the split tree. Leaves hold a pane, other nodes are split in two
+type PaneLayout struct {
+	Pane *Pane
+	// Vertical places First and Second side by side, otherwise First is above Second
+	Vertical bool
+	First    *PaneLayout
+	Second   *PaneLayout
+	Parent   *PaneLayout
+}
+
+var ACTIVEPANE = &Pane{Buffer: BUFFERS[0]}
+var PANELAYOUT = &PaneLayout{Pane: ACTIVEPANE}
+
+// SCREENCOLS and SCREENROWS are the size of the whole terminal, COLS and ROWS that of the active pane
+var (
+	SCREENCOLS int
+	SCREENROWS int
+)
+
+// LayoutPanes divides the screen above the status bar between the panes, and sizes COLS and ROWS to the active one
+func LayoutPanes() {
+	// The sidebar and its separator take the left of the screen while they are shown
+	x := 0
+	if SIDEBAR.Visible {
+		x = SIDEBARWIDTH + 1
+	}
+	layoutNode(PANELAYOUT, x, 0, SCREENCOLS-x, SCREENROWS-1)
+	applyActivePaneSize()
+}
+
+func layoutNode(node *PaneLayout, x, y, width, height int) {
+	if node.Pane != nil {
+		node.Pane.X, node.Pane.Y = x, y
+		node.Pane.Width, node.Pane.Height = width, height
+		return
+	}
+	// One column or row between the two halves is left for the separator
+	if node.Vertical {
+		firstWidth := (width - 1) / 2
+		layoutNode(node.First, x, y, firstWidth, height)
+		layoutNode(node.Second, x+firstWidth+1, y, width-firstWidth-1, height)
+	} else {
+		firstHeight := (height - 1) / 2
+		layoutNode(node.First, x, y, width, firstHeight)
+		layoutNode(node.Second, x, y+firstHeight+1, width, height-firstHeight-1)
+	}
+}
+
+// applyActivePaneSize sets COLS and ROWS from the active pane.
+// As everywhere else, ROWS is the index of the last row drawn, not the row count
+func applyActivePaneSize() {
+	COLS = ACTIVEPANE.Width - LINECOUNTWIDTH
+	ROWS = ACTIVEPANE.Height - 1
+	if COLS < 1 {
+		COLS = 1
+	}
+	if ROWS < 1 {
+		ROWS = 1
+	}
+}
+
+// PanesInOrder returns every pane, left to right and top to bottom
+func PanesInOrder() []*Pane {
+	return collectPanes(PANELAYOUT, nil)
+}
+
+func collectPanes(node *PaneLayout, panes []*Pane) []*Pane {
+	if node.Pane != nil {
+		return append(panes, node.Pane)
+	}
+	panes = collectPanes(node.First, panes)
+	return collectPanes(node.Second, panes)
+}
+
+// findLayout returns the leaf holding pane, or nil if it isn't in the tree
+func findLayout(node *PaneLayout, pane *Pane) *PaneLayout {
+	if node.Pane != nil {
+		if node.Pane == pane {
+			return node
+		}
+		return nil
+	}
+	if found := findLayout(node.First, pane); found != nil {
+		return found
+	}
+	return findLayout(node.Second, pane)
+}
+
+// storeActivePane copies the globals back into the active pane
+func storeActivePane() {
+	ACTIVEPANE.Buffer = BUFFERS[CURRENTBUFFER]
+	ACTIVEPANE.CursorX = CURSORX - LINECOUNTWIDTH
+	ACTIVEPANE.CursorY = CURSORY
+	ACTIVEPANE.OffsetX = OFFSETX
+	ACTIVEPANE.OffsetY = OFFSETY
+}
+
+// FocusPane makes pane the active one, loading its buffer and its own cursor into the globals
+func FocusPane(pane *Pane) {
+	storeActiveBuffer()
+	storeActivePane()
+	loadPane(pane)
+}
+
+// loadPane makes pane the active one without storing the previously active pane
+func loadPane(pane *Pane) {
+	ACTIVEPANE = pane
+	applyActivePaneSize()
+
+	index := indexOfBuffer(pane.Buffer)
+	if index < 0 {
+		index = CURRENTBUFFER
+	}
+	loadBuffer(index)
+	OFFSETX = pane.OffsetX
+	OFFSETY = pane.OffsetY
+	// The buffer may have been edited from another pane, so the cursor is clamped on the way in
+	MoveCursorTo(pane.OffsetY+pane.CursorY, pane.OffsetX+pane.CursorX)
+}
+
+// NextPane moves focus to the pane after the active one, wrapping around
+func NextPane() {
+	panes := PanesInOrder()
+	for i, pane := range panes {
+		if pane == ACTIVEPANE {
+			FocusPane(panes[(i+1)%len(panes)])
+			return
+		}
+	}
+}
+
+// SplitPane splits the active pane in two, both showing the active buffer, and focuses the new half
+func SplitPane(vertical bool) {
+	storeActiveBuffer()
+	storeActivePane()
+
+	leaf := findLayout(PANELAYOUT, ACTIVEPANE)
+	newPane := *ACTIVEPANE
+	leaf.First = &PaneLayout{Pane: ACTIVEPANE, Parent: leaf}
+	leaf.Second = &PaneLayout{Pane: &newPane, Parent: leaf}
+	leaf.Pane = nil
+	leaf.Vertical = vertical
+
+	LayoutPanes()
+	FocusPane(&newPane)
+}
+
+// ClosePane closes the active pane and gives its space to its sibling.
+// The buffer it showed stays open. Returns false if it is the only pane
+func ClosePane() bool {
+	leaf := findLayout(PANELAYOUT, ACTIVEPANE)
+	if leaf.Parent == nil {
+		return false
+	}
+	storeActiveBuffer()
+
+	parent := leaf.Parent
+	sibling := parent.First
+	if sibling == leaf {
+		sibling = parent.Second
+	}
+	parent.Pane = sibling.Pane
+	parent.Vertical = sibling.Vertical
+	parent.First = sibling.First
+	parent.Second = sibling.Second
+	if parent.First != nil {
+		parent.First.Parent = parent
+		parent.Second.Parent = parent
+	}
+
+	LayoutPanes()
+	// The closed pane is no longer in the tree, so it is dropped instead of stored
+	loadPane(collectPanes(parent, nil)[0])
+	return true
+}
+
+// syncPanesWithBuffers points panes whose buffer was closed or replaced at the active buffer
+func syncPanesWithBuffers() {
+	for _, pane := range PanesInOrder() {
+		if pane == ACTIVEPANE || indexOfBuffer(pane.Buffer) >= 0 {
+			continue
+		}
+		pane.Buffer = BUFFERS[CURRENTBUFFER]
+		pane.CursorX, pane.CursorY = 0, 0
+		pane.OffsetX, pane.OffsetY = 0, 0
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// pathSeparators are the characters a typed path is split on, "/" works on every OS
+const pathSeparators = "/" + string(os.PathSeparator)
+
+// ExpandPath expands a leading ~ to the home directory and $VAR or ${VAR} to environment variables
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(os.PathSeparator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return path
+}
+
+// CompletePath completes the last component of a typed path as far as the names in its directory agree.
+// A directory that is completed fully gets a trailing "/". When more than one name fits,
+// they are returned as candidates, directories with a trailing "/"
+func CompletePath(typed string) (string, []string) {
+	typedDir, prefix := "", typed
+	if i := strings.LastIndexAny(typed, pathSeparators); i >= 0 {
+		typedDir, prefix = typed[:i+1], typed[i+1:]
+	}
+	dir := ExpandPath(typedDir)
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return typed, nil
+	}
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hidden files only show up once a "." is typed
+		if !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if entry.IsDir() || isDirLink(filepath.Join(dir, name)) {
+			name += "/"
+		}
+		candidates = append(candidates, name)
+	}
+	if len(candidates) == 0 {
+		return typed, nil
+	}
+	if len(candidates) == 1 {
+		return typedDir + candidates[0], nil
+	}
+
+	sort.Strings(candidates)
+	return typedDir + commonPrefix(candidates), candidates
+}
+
+// commonPrefix returns the longest prefix all the candidates share, trimmed by whole runes so it stays valid UTF-8
+func commonPrefix(candidates []string) string {
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	return common
+}
+
+// isDirLink reports whether a path is a symlink to a directory
+func isDirLink(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+)
+
+// processAlive reports whether a process with the given pid is running
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists but belongs to someone else
+	return err == nil || err == syscall.EPERM
+}
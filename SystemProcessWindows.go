@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// processAlive reports whether a process with the given pid is running
+func processAlive(pid int) bool {
+	// On Windows FindProcess opens a handle, which fails if the process is gone
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
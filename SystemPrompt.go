@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// PromptInput is the text typed into a prompt, with a cursor that can move inside it
+// and Up/Down access to what was entered in the prompt before
+type PromptInput struct {
+	Text   []rune
+	Cursor int
+	// history holds earlier entries, oldest first. historyIndex is the entry shown,
+	// len(history) while none is, and draft keeps the text typed before browsing started
+	history      []string
+	historyIndex int
+	draft        []rune
+}
+
+// MAXPROMPTHISTORY is how many entries each prompt's history keeps
+const MAXPROMPTHISTORY = 100
+
+// NewPromptInput returns an empty prompt with the history saved under name
+func NewPromptInput(name string) *PromptInput {
+	history := LoadPromptHistory(name)
+	return &PromptInput{history: history, historyIndex: len(history)}
+}
+
+// String returns the typed text
+func (input *PromptInput) String() string {
+	return string(input.Text)
+}
+
+// Set replaces the typed text, putting the cursor at its end
+func (input *PromptInput) Set(text string) {
+	input.Text = []rune(text)
+	input.Cursor = len(input.Text)
+}
+
+// HandleKey applies an editing key to the prompt: typing, Backspace, Delete, Left, Right, Home and End,
+// and Ctrl-A/Ctrl-E to go to the start/end, Ctrl-W to delete the word before the cursor and Ctrl-U everything before it.
+// Returns true if the key was one of them
+func (input *PromptInput) HandleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyLeft:
+		if input.Cursor > 0 {
+			input.Cursor--
+		}
+	case tcell.KeyRight:
+		if input.Cursor < len(input.Text) {
+			input.Cursor++
+		}
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		input.Cursor = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		input.Cursor = len(input.Text)
+	case tcell.KeyCtrlW:
+		start := input.Cursor
+		for start > 0 && unicode.IsSpace(input.Text[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(input.Text[start-1]) {
+			start--
+		}
+		input.Text = append(input.Text[:start], input.Text[input.Cursor:]...)
+		input.Cursor = start
+	case tcell.KeyCtrlU:
+		input.Text = append([]rune{}, input.Text[input.Cursor:]...)
+		input.Cursor = 0
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if input.Cursor > 0 {
+			input.Text = append(input.Text[:input.Cursor-1], input.Text[input.Cursor:]...)
+			input.Cursor--
+		}
+	case tcell.KeyDelete:
+		if input.Cursor < len(input.Text) {
+			input.Text = append(input.Text[:input.Cursor], input.Text[input.Cursor+1:]...)
+		}
+	case tcell.KeyRune:
+		input.Text = append(input.Text[:input.Cursor], append([]rune{ev.Rune()}, input.Text[input.Cursor:]...)...)
+		input.Cursor++
+	default:
+		return false
+	}
+	return true
+}
+
+// Reset empties the prompt and stops browsing its history
+func (input *PromptInput) Reset() {
+	input.Set("")
+	input.historyIndex = len(input.history)
+}
+
+// Browsing reports whether an entry from the history is being shown
+func (input *PromptInput) Browsing() bool {
+	return input.historyIndex < len(input.history)
+}
+
+// HistoryPrev shows the entry before the one shown, returning false at the oldest
+func (input *PromptInput) HistoryPrev() bool {
+	if input.historyIndex == 0 {
+		return false
+	}
+	if !input.Browsing() {
+		input.draft = append([]rune{}, input.Text...)
+	}
+	input.historyIndex--
+	input.Set(input.history[input.historyIndex])
+	return true
+}
+
+// HistoryNext shows the entry after the one shown, and the text typed before browsing after the newest.
+// Returns false if no entry was being shown
+func (input *PromptInput) HistoryNext() bool {
+	if !input.Browsing() {
+		return false
+	}
+	input.historyIndex++
+	if input.Browsing() {
+		input.Set(input.history[input.historyIndex])
+	} else {
+		input.Set(string(input.draft))
+	}
+	return true
+}
+
+// displayPromptInput prints the typed text with the cell under the cursor reversed
+func displayPromptInput(col, row int, style tcell.Style, input *PromptInput) {
+	text := append(append([]rune{}, input.Text...), ' ')
+	for i, char := range text {
+		charStyle := style
+		if i == input.Cursor {
+			charStyle = style.Reverse(true)
+		}
+		TERMINAL.SetContent(col, row, char, nil, charStyle)
+		col += runewidth.RuneWidth(char)
+	}
+}
+
+// promptHistoryPath returns the file the prompt histories are kept in, next to config.json
+func promptHistoryPath() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "history.json"), nil
+}
+
+// loadPromptHistories reads the histories of every prompt, by prompt name
+func loadPromptHistories() map[string][]string {
+	histories := map[string][]string{}
+	path, err := promptHistoryPath()
+	if err != nil {
+		return histories
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return histories
+	}
+	json.Unmarshal(data, &histories)
+	return histories
+}
+
+// LoadPromptHistory returns the entries saved for a prompt, oldest first
+func LoadPromptHistory(name string) []string {
+	return loadPromptHistories()[name]
+}
+
+// AddPromptHistory saves an entry to a prompt's history. An entry already in it moves to the end
+func AddPromptHistory(name, entry string) {
+	if entry == "" {
+		return
+	}
+	histories := loadPromptHistories()
+	var history []string
+	for _, old := range histories[name] {
+		if old != entry {
+			history = append(history, old)
+		}
+	}
+	history = append(history, entry)
+	if len(history) > MAXPROMPTHISTORY {
+		history = history[len(history)-MAXPROMPTHISTORY:]
+	}
+	histories[name] = history
+
+	path, err := promptHistoryPath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(histories, "", "  ")
+	if err != nil {
+		return
+	}
+	// History is a convenience, so failing to save it isn't worth interrupting anyone over
+	os.WriteFile(path, data, 0644)
+}
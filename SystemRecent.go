@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RecentFile is a file opened before, with where its cursor and scroll were last
+type RecentFile struct {
+	Path    string    `json:"path"`
+	Line    int       `json:"line"`
+	Col     int       `json:"col"`
+	OffsetX int       `json:"offset_x"`
+	OffsetY int       `json:"offset_y"`
+	Used    time.Time `json:"used"`
+}
+
+// RecentState is what recent.json holds: the recent files, most recent first,
+// and the files that were open when STE last exited, with the index of the one that was active
+type RecentState struct {
+	Files   []RecentFile `json:"files"`
+	Session []string     `json:"session"`
+	Current int          `json:"current"`
+}
+
+// MAXRECENTFILES is how many files the recent list keeps
+const MAXRECENTFILES = 50
+
+// recentPath returns the file the recent files are kept in, next to config.json
+func recentPath() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "recent.json"), nil
+}
+
+// LoadRecent reads the recent files and last session, an unreadable file gives an empty list
+func LoadRecent() RecentState {
+	var state RecentState
+	path, err := recentPath()
+	if err != nil {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	json.Unmarshal(data, &state)
+	return state
+}
+
+// saveRecent writes the recent files and last session. Like the prompt history, failing to is not reported
+func saveRecent(state RecentState) {
+	path, err := recentPath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0644)
+}
+
+// remember puts a buffer's file at the top of the recent files, with the buffer's position in it
+func (state *RecentState) remember(buffer *Buffer) {
+	if buffer.SourceFile == "" {
+		return
+	}
+	path, err := filepath.Abs(buffer.SourceFile)
+	if err != nil {
+		return
+	}
+
+	files := []RecentFile{{
+		Path:    path,
+		Line:    buffer.OffsetY + buffer.CursorY,
+		Col:     buffer.OffsetX + buffer.CursorX,
+		OffsetX: buffer.OffsetX,
+		OffsetY: buffer.OffsetY,
+		Used:    time.Now(),
+	}}
+	for _, recent := range state.Files {
+		if recent.Path != path {
+			files = append(files, recent)
+		}
+	}
+	if len(files) > MAXRECENTFILES {
+		files = files[:MAXRECENTFILES]
+	}
+	state.Files = files
+}
+
+// RememberBuffer saves a buffer's file and position to the recent files
+func RememberBuffer(buffer *Buffer) {
+	state := LoadRecent()
+	state.remember(buffer)
+	saveRecent(state)
+}
+
+// SaveSession saves the position of every open file, and which files are open, for --restore
+func SaveSession() {
+	storeActiveBuffer()
+	state := LoadRecent()
+	state.Session = nil
+	state.Current = 0
+	// Going backwards leaves the active buffer's file on top of the recent files
+	for i := len(BUFFERS) - 1; i >= 0; i-- {
+		if i != CURRENTBUFFER {
+			state.remember(BUFFERS[i])
+		}
+	}
+	state.remember(BUFFERS[CURRENTBUFFER])
+
+	for i, buffer := range BUFFERS {
+		if buffer.SourceFile == "" {
+			continue
+		}
+		path, err := filepath.Abs(buffer.SourceFile)
+		if err != nil {
+			continue
+		}
+		if i == CURRENTBUFFER {
+			state.Current = len(state.Session)
+		}
+		state.Session = append(state.Session, path)
+	}
+	saveRecent(state)
+}
+
+// restorePosition puts a buffer's cursor and scroll back where they were when its file was last used.
+// loadBuffer clamps them if the file has changed since
+func restorePosition(buffer *Buffer) {
+	path, err := filepath.Abs(buffer.SourceFile)
+	if err != nil {
+		return
+	}
+	for _, recent := range LoadRecent().Files {
+		if recent.Path != path {
+			continue
+		}
+		buffer.OffsetX, buffer.OffsetY = recent.OffsetX, recent.OffsetY
+		buffer.CursorX, buffer.CursorY = recent.Col-recent.OffsetX, recent.Line-recent.OffsetY
+		return
+	}
+}
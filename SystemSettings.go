@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -20,8 +21,20 @@ type Settings struct {
 	MsgFGColor       tcell.Color `json:"msg_fg_color"`
 	LineCountBGColor tcell.Color `json:"line_count_bg_color"`
 	LineCountFGColor tcell.Color `json:"line_count_fg_color"`
+	// AutosaveIdleSeconds saves the active buffer after that many seconds without input, 0 turns it off
+	AutosaveIdleSeconds int  `json:"autosave_idle_seconds"`
+	AutosaveOnFocusLost bool `json:"autosave_on_focus_lost"`
+	// Aliases maps names to commands for the status bar, like "wq": "save; quit"
+	Aliases map[string]string `json:"aliases"`
+	// Keys binds keys and chords like "Ctrl-K Ctrl-S" to commands, in command mode and while writing
+	Keys KeySettings `json:"keys"`
+	// KeymapPreset "vim" turns on vim-style modal editing
+	KeymapPreset string `json:"keymap_preset"`
 }
 
+// SETTINGS holds the settings last applied, so saving the colors keeps everything else as configured
+var SETTINGS = GetDefaultSettings()
+
 // GetDefaultSettings returns the default configuration
 func GetDefaultSettings() Settings {
 	return Settings{
@@ -33,21 +46,90 @@ func GetDefaultSettings() Settings {
 		MsgFGColor:       tcell.ColorBlack,
 		LineCountBGColor: tcell.ColorWhite,
 		LineCountFGColor: tcell.ColorLightBlue,
+		Aliases:          map[string]string{},
+		Keys:             KeySettings{Command: map[string]string{}, Write: map[string]string{}},
 	}
 }
 
-// SaveSettings saves the current settings to a JSON file
-func SaveSettings(settings Settings) error {
-	// Get OS-specific config directory
+// THEMES are the built-in color schemes that --theme picks from. Only the colors of a theme are used
+var THEMES = map[string]Settings{
+	"default": GetDefaultSettings(),
+	"light": {
+		BGColor:          tcell.ColorWhite,
+		FGColor:          tcell.ColorBlack,
+		StatusBGColor:    tcell.ColorDarkBlue,
+		StatusFGColor:    tcell.ColorWhite,
+		MsgBGColor:       tcell.ColorDarkBlue,
+		MsgFGColor:       tcell.ColorWhite,
+		LineCountBGColor: tcell.ColorLightGray,
+		LineCountFGColor: tcell.ColorDarkBlue,
+	},
+	"dark": {
+		BGColor:          tcell.ColorBlack,
+		FGColor:          tcell.ColorLightGray,
+		StatusBGColor:    tcell.ColorDarkSlateGray,
+		StatusFGColor:    tcell.ColorWhite,
+		MsgBGColor:       tcell.ColorDarkSlateGray,
+		MsgFGColor:       tcell.ColorWhite,
+		LineCountBGColor: tcell.ColorBlack,
+		LineCountFGColor: tcell.ColorGray,
+	},
+}
+
+// ApplyTheme applies the colors of a built-in theme on top of the current settings, returning false for unknown themes
+func ApplyTheme(name string) bool {
+	theme, ok := THEMES[name]
+	if !ok {
+		return false
+	}
+	settings := SETTINGS
+	settings.BGColor = theme.BGColor
+	settings.FGColor = theme.FGColor
+	settings.StatusBGColor = theme.StatusBGColor
+	settings.StatusFGColor = theme.StatusFGColor
+	settings.MsgBGColor = theme.MsgBGColor
+	settings.MsgFGColor = theme.MsgFGColor
+	settings.LineCountBGColor = theme.LineCountBGColor
+	settings.LineCountFGColor = theme.LineCountFGColor
+	ApplySettings(settings)
+	return true
+}
+
+// CONFIGPATH replaces the default config.json when set, from the --config option
+var CONFIGPATH = ""
+
+// configFilePath returns where the settings are read from and saved to
+func configFilePath() (string, error) {
+	if CONFIGPATH != "" {
+		return CONFIGPATH, nil
+	}
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// ConfigDir returns the OS-specific directory STE keeps its files in, creating it if needed
+func ConfigDir() (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
-		return fmt.Errorf("failed to get user config directory: %w", err)
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
 	}
 	configDir = filepath.Join(configDir, "SlessingTextEditor")
 
 	// Ensure the config directory exists
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return configDir, nil
+}
+
+// SaveSettings saves the current settings to a JSON file
+func SaveSettings(settings Settings) error {
+	configPath, err := configFilePath()
+	if err != nil {
+		return err
 	}
 
 	// Convert settings to JSON string
@@ -57,7 +139,6 @@ func SaveSettings(settings Settings) error {
 	}
 
 	// Write to file using similar pattern to WriteBufferToFile
-	configPath := filepath.Join(configDir, "config.json")
 	file, err := os.Create(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to create config file: %w", err)
@@ -77,14 +158,10 @@ func SaveSettings(settings Settings) error {
 
 // LoadSettings loads settings from a JSON file, creating default config if file doesn't exist
 func LoadSettings() (Settings, error) {
-	// Get OS-specific config directory
-	configDir, err := os.UserConfigDir()
+	configPath, err := configFilePath()
 	if err != nil {
-		return Settings{}, fmt.Errorf("failed to get user config directory: %w", err)
+		return Settings{}, err
 	}
-	configDir = filepath.Join(configDir, "SlessingTextEditor")
-
-	configPath := filepath.Join(configDir, "config.json")
 
 	// Try to open the file, similar to OpenFile pattern
 	file, err := os.Open(configPath)
@@ -136,31 +213,42 @@ func JSONToSettings(jsonStr string) (Settings, error) {
 	return settings, nil
 }
 
-// ApplySettings applies the loaded settings to the global color variables
+// ApplySettings applies the loaded settings to the global color, autosave, alias and key binding variables
 func ApplySettings(settings Settings) {
+	SETTINGS = settings
 	STYLES.MAINSTYLE = tcell.StyleDefault.Background(settings.BGColor).Foreground(settings.FGColor)
 	STYLES.STATUSSTYLE = tcell.StyleDefault.Background(settings.StatusBGColor).Foreground(settings.StatusFGColor)
 	STYLES.MSGSTYLE = tcell.StyleDefault.Background(settings.MsgBGColor).Foreground(settings.MsgFGColor)
 	STYLES.LINECOUNTSTYLE = tcell.StyleDefault.Background(settings.LineCountBGColor).Foreground(settings.LineCountFGColor)
-
+	AUTOSAVEIDLE = time.Duration(settings.AutosaveIdleSeconds) * time.Second
+	AUTOSAVEONFOCUSLOST = settings.AutosaveOnFocusLost
+	applyAliases(settings.Aliases)
+	applyKeymaps(settings.Keys)
+	switch settings.KeymapPreset {
+	case "", "vim":
+		SetVimKeys(settings.KeymapPreset == "vim")
+	default:
+		STATUSMESSAGE = fmt.Sprintf("Unknown keymap_preset %q in config.json, use \"vim\" or leave it out", settings.KeymapPreset)
+	}
 }
 
-// GetCurrentSettings creates a Settings struct from the current global variables
+// GetCurrentSettings creates a Settings struct from the current global color variables.
+// Everything else comes from SETTINGS, so session-only changes like the autosave command aren't saved
 func GetCurrentSettings() Settings {
 	mainfg, mainbg, _ := STYLES.MAINSTYLE.Decompose()
 	statusfg, statusbg, _ := STYLES.STATUSSTYLE.Decompose()
 	msgfg, msgbg, _ := STYLES.MSGSTYLE.Decompose()
 	linecountfg, linecountbg, _ := STYLES.LINECOUNTSTYLE.Decompose()
-	return Settings{
-		BGColor:          mainbg,
-		FGColor:          mainfg,
-		StatusBGColor:    statusbg,
-		StatusFGColor:    statusfg,
-		MsgBGColor:       msgbg,
-		MsgFGColor:       msgfg,
-		LineCountBGColor: linecountbg,
-		LineCountFGColor: linecountfg,
-	}
+	settings := SETTINGS
+	settings.BGColor = mainbg
+	settings.FGColor = mainfg
+	settings.StatusBGColor = statusbg
+	settings.StatusFGColor = statusfg
+	settings.MsgBGColor = msgbg
+	settings.MsgFGColor = msgfg
+	settings.LineCountBGColor = linecountbg
+	settings.LineCountFGColor = linecountfg
+	return settings
 }
 
 // Example usage:
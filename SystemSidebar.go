@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sidebar is the file tree shown left of the panes. Directories are read when they are first expanded,
+// and skip .git and whatever .gitignore ignores, like the file finder
+type Sidebar struct {
+	Visible bool
+	// Focused is set while SidebarLoop has the keyboard
+	Focused bool
+	// Root is the directory the tree starts at, the working directory when the sidebar was first shown
+	Root     string
+	Selected int
+	Scroll   int
+	expanded map[string]bool
+	children map[string][]BrowserEntry
+	ignore   IgnoreRules
+}
+
+// TreeRow is one visible line of the sidebar
+type TreeRow struct {
+	Path  string
+	Name  string
+	Depth int
+	IsDir bool
+}
+
+// SIDEBARWIDTH is the width of the sidebar, not counting the separator next to it
+const SIDEBARWIDTH = 30
+
+var SIDEBAR = &Sidebar{}
+
+// ToggleSidebar shows or hides the sidebar, making room for it by moving the panes over
+func ToggleSidebar() {
+	SIDEBAR.Visible = !SIDEBAR.Visible
+	if SIDEBAR.Visible && SIDEBAR.Root == "" {
+		root, err := filepath.Abs(".")
+		if err != nil {
+			root = "."
+		}
+		SIDEBAR.Root = root
+	}
+	SIDEBAR.Refresh()
+	LayoutPanes()
+	// The active pane changed width, so the cursor may need to scroll into view again
+	position := CursorPosition()
+	MoveCursorTo(position.Line, position.Col)
+}
+
+// Refresh forgets the directories read so far, so they are read again. Expanded directories stay expanded
+func (sidebar *Sidebar) Refresh() {
+	sidebar.children = map[string][]BrowserEntry{}
+	sidebar.ignore = readIgnoreFile(sidebar.Root, "")
+	if sidebar.expanded == nil {
+		sidebar.expanded = map[string]bool{}
+	}
+}
+
+// entriesOf returns the entries of a directory in the tree, reading it the first time
+func (sidebar *Sidebar) entriesOf(dir string) []BrowserEntry {
+	if entries, ok := sidebar.children[dir]; ok {
+		return entries
+	}
+	rel := sidebar.relPath(dir)
+	if rel != "" {
+		sidebar.ignore = append(sidebar.ignore, readIgnoreFile(dir, rel)...)
+	}
+
+	var entries []BrowserEntry
+	listed, _ := ListDirectory(dir)
+	for _, entry := range listed {
+		if entry.Name == ".." || entry.Name == ".git" || strings.HasSuffix(entry.Name, ".ste-lock") {
+			continue
+		}
+		entryRel := entry.Name
+		if rel != "" {
+			entryRel = rel + "/" + entry.Name
+		}
+		if sidebar.ignore.Ignored(entryRel, entry.IsDir) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sidebar.children[dir] = entries
+	return entries
+}
+
+// relPath returns a path relative to the tree's root with "/" separators, "" for the root itself
+func (sidebar *Sidebar) relPath(path string) string {
+	rel, err := filepath.Rel(sidebar.Root, path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Rows returns the lines of the tree as it is expanded now
+func (sidebar *Sidebar) Rows() []TreeRow {
+	var rows []TreeRow
+	var addDir func(dir string, depth int)
+	addDir = func(dir string, depth int) {
+		for _, entry := range sidebar.entriesOf(dir) {
+			path := filepath.Join(dir, entry.Name)
+			rows = append(rows, TreeRow{Path: path, Name: entry.Name, Depth: depth, IsDir: entry.IsDir})
+			if entry.IsDir && sidebar.expanded[path] {
+				addDir(path, depth+1)
+			}
+		}
+	}
+	addDir(sidebar.Root, 0)
+	return rows
+}
+
+// SetExpanded expands or collapses a directory of the tree
+func (sidebar *Sidebar) SetExpanded(path string, expanded bool) {
+	if expanded {
+		sidebar.expanded[path] = true
+	} else {
+		delete(sidebar.expanded, path)
+	}
+}
+
+// displaySidebar draws the tree left of the panes, marking the active buffer's file.
+// The picked row is only highlighted while the sidebar has focus
+func displaySidebar() {
+	height := SCREENROWS - 1
+	for row := 0; row < height; row++ {
+		for col := 0; col < SIDEBARWIDTH; col++ {
+			TERMINAL.SetContent(col, row, ' ', nil, STYLES.MAINSTYLE)
+		}
+		TERMINAL.SetContent(SIDEBARWIDTH, row, '│', nil, STYLES.LINECOUNTSTYLE)
+	}
+
+	current := ""
+	if SOURCEFILE != "" {
+		if path, err := filepath.Abs(SOURCEFILE); err == nil {
+			current = path
+		}
+	}
+
+	rows := SIDEBAR.Rows()
+	for row := 0; row < height && SIDEBAR.Scroll+row < len(rows); row++ {
+		treeRow := rows[SIDEBAR.Scroll+row]
+		style := STYLES.MAINSTYLE
+		if SIDEBAR.Focused && SIDEBAR.Scroll+row == SIDEBAR.Selected {
+			style = style.Reverse(true)
+			for col := 0; col < SIDEBARWIDTH; col++ {
+				TERMINAL.SetContent(col, row, ' ', nil, style)
+			}
+		}
+
+		marker := "  "
+		if treeRow.IsDir && SIDEBAR.expanded[treeRow.Path] {
+			marker = "▾ "
+		} else if treeRow.IsDir {
+			marker = "▸ "
+		} else if treeRow.Path == current {
+			marker = "● "
+			style = style.Bold(true)
+		}
+		name := treeRow.Name
+		if treeRow.IsDir {
+			name += string(os.PathSeparator)
+		}
+		printClipped(1, row, SIDEBARWIDTH, style, strings.Repeat("  ", treeRow.Depth)+marker+name)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SwapFile is the on-disk journal of a buffer with unsaved changes, used to recover it after a crash
+type SwapFile struct {
+	SourceFile string     `json:"source_file"`
+	PID        int        `json:"pid"`
+	Saved      time.Time  `json:"saved"`
+	Format     FileFormat `json:"format"`
+	Lines      []string   `json:"lines"`
+	// Path is where the swap file was read from
+	Path string `json:"-"`
+}
+
+// A buffer's swap file is rewritten once SWAPINTERVAL has passed since the last write, or sooner after SWAPEDITS changes
+const SWAPINTERVAL = 4 * time.Second
+const SWAPEDITS = 200
+
+// SwapDir returns the directory swap files are kept in, creating it if needed
+func SwapDir() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	swapDir := filepath.Join(configDir, "swap")
+	if err := os.MkdirAll(swapDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create swap directory: %w", err)
+	}
+	return swapDir, nil
+}
+
+// swapPathFor returns the swap file a buffer journals to.
+// Named buffers use a hash of their absolute path, unnamed ones a timestamp. Both carry this process's PID,
+// so two instances editing the same file never write or remove each other's journal
+func swapPathFor(buffer *Buffer) (string, error) {
+	swapDir, err := SwapDir()
+	if err != nil {
+		return "", err
+	}
+	if buffer.SourceFile == "" {
+		if strings.HasPrefix(filepath.Base(buffer.SwapPath), "unnamed-") {
+			return buffer.SwapPath, nil
+		}
+		name := fmt.Sprintf("unnamed-%d-%d.swp", os.Getpid(), time.Now().UnixNano())
+		return filepath.Join(swapDir, name), nil
+	}
+	path, err := filepath.Abs(buffer.SourceFile)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(path))
+	name := fmt.Sprintf("%x-%d.swp", sum[:8], os.Getpid())
+	return filepath.Join(swapDir, name), nil
+}
+
+// UpdateSwapFiles writes the swap files of buffers with unsaved changes when they are due,
+// and removes the swap files of buffers that have been saved since
+func UpdateSwapFiles() {
+	updateSwapFiles(false)
+}
+
+// FlushSwapFiles writes the swap file of every buffer with changes that aren't in it yet, due or not
+func FlushSwapFiles() {
+	updateSwapFiles(true)
+}
+
+func updateSwapFiles(force bool) {
+	storeActiveBuffer()
+	for _, buffer := range BUFFERS {
+		if !buffer.Modified {
+			removeSwapFile(buffer)
+			continue
+		}
+		pending := buffer.History.Changes - buffer.swapChanges
+		if pending == 0 {
+			continue
+		}
+		if !force && pending < SWAPEDITS && time.Since(buffer.swapTime) < SWAPINTERVAL {
+			continue
+		}
+		if err := writeSwapFile(buffer); err != nil {
+			STATUSMESSAGE = fmt.Sprintf("Couldnt write swap file: %s", err.Error())
+		}
+	}
+}
+
+// writeSwapFile journals a buffer's current text to its swap file
+func writeSwapFile(buffer *Buffer) error {
+	path, err := swapPathFor(buffer)
+	if err != nil {
+		return err
+	}
+	// Save-as gives the buffer a new swap file, so the one under the old name goes
+	if buffer.SwapPath != "" && buffer.SwapPath != path {
+		os.Remove(buffer.SwapPath)
+	}
+
+	lines := make([]string, len(buffer.TextBuffer))
+	for i, line := range buffer.TextBuffer {
+		lines[i] = string(line)
+	}
+	data, err := json.Marshal(SwapFile{
+		SourceFile: buffer.SourceFile,
+		PID:        os.Getpid(),
+		Saved:      time.Now(),
+		Format:     buffer.Format,
+		Lines:      lines,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Written next to the swap file and renamed, so a crash mid-write can't destroy the previous one
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	buffer.SwapPath = path
+	buffer.swapChanges = buffer.History.Changes
+	buffer.swapTime = time.Now()
+	return nil
+}
+
+// removeSwapFile deletes a buffer's swap file, if it has one
+func removeSwapFile(buffer *Buffer) {
+	if buffer.SwapPath == "" {
+		return
+	}
+	os.Remove(buffer.SwapPath)
+	buffer.SwapPath = ""
+}
+
+// RemoveAllSwapFiles deletes the swap files of every open buffer, used when STE exits normally
+func RemoveAllSwapFiles() {
+	for _, buffer := range BUFFERS {
+		removeSwapFile(buffer)
+	}
+}
+
+// ListSwapFiles returns the swap files left behind by STE instances that are no longer running
+func ListSwapFiles() ([]SwapFile, error) {
+	swapDir, err := SwapDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(swapDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swap directory: %w", err)
+	}
+
+	var swaps []SwapFile
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".swp" {
+			continue
+		}
+		path := filepath.Join(swapDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var swap SwapFile
+		if err := json.Unmarshal(data, &swap); err != nil {
+			continue
+		}
+		// Swap files of a running STE belong to it, and are still being written
+		if swap.PID == os.Getpid() || processAlive(swap.PID) {
+			continue
+		}
+		swap.Path = path
+		swaps = append(swaps, swap)
+	}
+	return swaps, nil
+}
@@ -1,5 +1,5 @@
 package main
 
 func UpdateFromGIT() {
-	PrintMessageStyle(COLS/2, ROWS/2, STYLES.MSGSTYLE, "NOT IMPLEMENTED YET; COMING SOON")
+	PrintMessageStyle(SCREENCOLS/2, SCREENROWS/2, STYLES.MSGSTYLE, "NOT IMPLEMENTED YET; COMING SOON")
 }
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Vim modes, as the status bar shows them
+const (
+	VIMNORMAL     = "NORMAL"
+	VIMINSERT     = "INSERT"
+	VIMVISUAL     = "VISUAL"
+	VIMVISUALLINE = "VISUAL LINE"
+	VIMCOMMAND    = "COMMAND"
+)
+
+// VimRegister holds the text last yanked or deleted. Linewise text is whole lines, without the last line break
+type VimRegister struct {
+	Text     string
+	Linewise bool
+}
+
+// VimState is the state of the vim keymap preset
+type VimState struct {
+	Enabled bool
+	Mode    string
+	// Pending holds the keys of a command typed so far, like "2d"
+	Pending []string
+	// Anchor is where the visual selection started, the cursor is its other end
+	Anchor   BufferPos
+	Register VimRegister
+	// WantCol is the column j and k try to keep, -1 after $ to stay at the end of lines
+	WantCol int
+	// LastChange and LastInsert are what . repeats: the command and the keys typed in insert mode after it
+	LastChange *vimCommand
+	LastInsert []*tcell.EventKey
+}
+
+var VIM = &VimState{Mode: VIMNORMAL}
+
+// vimCommand is a parsed normal or visual mode command, like "3dw" or "ci("
+type vimCommand struct {
+	Count    int
+	Operator string
+	// Key is the action or motion, like "x", "w", "gg", "iw", or the operator again for "dd"
+	Key  string
+	Char string
+	// MotionCount is the count typed after the operator, as in "d3w"
+	MotionCount int
+}
+
+// vimMotions take the cursor somewhere, and can follow an operator. f, F, t and T are followed by a character
+var vimMotions = map[string]bool{
+	"h": true, "j": true, "k": true, "l": true, "w": true, "W": true, "b": true, "B": true, "e": true, "E": true,
+	"0": true, "^": true, "$": true, "gg": true, "G": true, "f": true, "F": true, "t": true, "T": true,
+	"{": true, "}": true, "Left": true, "Right": true, "Up": true, "Down": true,
+}
+
+// vimActions are the normal mode commands that aren't motions. r is followed by a character
+var vimActions = map[string]bool{
+	"x": true, "X": true, "s": true, "S": true, "D": true, "C": true, "Y": true, "p": true, "P": true,
+	"J": true, "r": true, "u": true, "Ctrl-R": true, ".": true, "i": true, "a": true, "I": true, "A": true,
+	"o": true, "O": true, "v": true, "V": true, ":": true,
+}
+
+// vimVisualActions are the visual mode commands that aren't motions
+var vimVisualActions = map[string]bool{
+	"d": true, "x": true, "X": true, "D": true, "y": true, "Y": true, "c": true, "s": true, "C": true, "S": true,
+	"J": true, "o": true, "v": true, "V": true, ":": true,
+}
+
+// vimObjects are the text objects, typed after i or a
+var vimObjects = "wW\"'`()b[]{}B<>"
+
+// parseVimCommand reads the keys typed so far into a command. complete is false while more keys are needed,
+// and ok is false when the keys can't start any command
+func parseVimCommand(keys []string, visual bool) (cmd vimCommand, complete bool, ok bool) {
+	i := 0
+	readCount := func() int {
+		count := 0
+		for i < len(keys) && len(keys[i]) == 1 && keys[i][0] >= '0' && keys[i][0] <= '9' {
+			if keys[i] == "0" && count == 0 {
+				break
+			}
+			count = count*10 + int(keys[i][0]-'0')
+			i++
+		}
+		return count
+	}
+	// readKey reads a motion, action or text object, with the character some of them take
+	readKey := func(allowed map[string]bool, objects bool) (string, string, bool, bool) {
+		if i >= len(keys) {
+			return "", "", false, true
+		}
+		key := keys[i]
+		i++
+		if key == "g" {
+			if i >= len(keys) {
+				return "", "", false, true
+			}
+			key += keys[i]
+			i++
+		}
+		if objects && (key == "i" || key == "a") {
+			if i >= len(keys) {
+				return "", "", false, true
+			}
+			object := keys[i]
+			i++
+			return key + object, "", true, len(object) == 1 && strings.Contains(vimObjects, object)
+		}
+		if !allowed[key] && !vimMotions[key] {
+			return "", "", false, false
+		}
+		if key == "f" || key == "F" || key == "t" || key == "T" || key == "r" {
+			if i >= len(keys) {
+				return "", "", false, true
+			}
+			char := keys[i]
+			i++
+			if key == "r" && char == "Enter" {
+				char = "\n"
+			}
+			return key, char, true, len([]rune(char)) == 1
+		}
+		return key, "", true, true
+	}
+
+	cmd.Count = readCount()
+	if visual {
+		key, char, done, valid := readKey(vimVisualActions, true)
+		cmd.Key, cmd.Char = key, char
+		return cmd, done, valid
+	}
+	if i < len(keys) && (keys[i] == "d" || keys[i] == "c" || keys[i] == "y") {
+		cmd.Operator = keys[i]
+		i++
+		cmd.MotionCount = readCount()
+		if i < len(keys) && keys[i] == cmd.Operator {
+			cmd.Key = cmd.Operator
+			return cmd, true, true
+		}
+		key, char, done, valid := readKey(nil, true)
+		cmd.Key, cmd.Char = key, char
+		return cmd, done, valid
+	}
+	key, char, done, valid := readKey(vimActions, false)
+	cmd.Key, cmd.Char = key, char
+	return cmd, done, valid
+}
+
+// vimChar returns the character at a position, with the end of a line read as a line break
+func vimChar(pos BufferPos) rune {
+	if pos.Col >= len(TEXTBUFFER[pos.Line]) {
+		return '\n'
+	}
+	return TEXTBUFFER[pos.Line][pos.Col]
+}
+
+// vimClass sorts characters into blanks (0), word characters (1) and other symbols (2).
+// For the big word motions W, B and E anything that isn't blank is a word character
+func vimClass(char rune, big bool) int {
+	switch {
+	case unicode.IsSpace(char):
+		return 0
+	case big || char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char):
+		return 1
+	}
+	return 2
+}
+
+// vimEmptyLine reports whether a position is on an empty line, which vim treats as a word
+func vimEmptyLine(pos BufferPos) bool {
+	return len(TEXTBUFFER[pos.Line]) == 0
+}
+
+// vimNext steps to the next position, the line break of each line included. Returns false at the end of the buffer
+func vimNext(pos BufferPos) (BufferPos, bool) {
+	if pos.Col < len(TEXTBUFFER[pos.Line]) {
+		return BufferPos{pos.Line, pos.Col + 1}, true
+	}
+	if pos.Line+1 < len(TEXTBUFFER) {
+		return BufferPos{pos.Line + 1, 0}, true
+	}
+	return pos, false
+}
+
+// vimPrev steps to the previous position. Returns false at the start of the buffer
+func vimPrev(pos BufferPos) (BufferPos, bool) {
+	if pos.Col > 0 {
+		return BufferPos{pos.Line, pos.Col - 1}, true
+	}
+	if pos.Line > 0 {
+		return BufferPos{pos.Line - 1, len(TEXTBUFFER[pos.Line-1])}, true
+	}
+	return pos, false
+}
+
+// vimWordStart is the w motion: the start of the next word, or the end of the buffer
+func vimWordStart(pos BufferPos, big bool) BufferPos {
+	class := vimClass(vimChar(pos), big)
+	pos, ok := vimNext(pos)
+	for ok && class != 0 && vimClass(vimChar(pos), big) == class {
+		pos, ok = vimNext(pos)
+	}
+	for ok && vimClass(vimChar(pos), big) == 0 && !vimEmptyLine(pos) {
+		pos, ok = vimNext(pos)
+	}
+	return pos
+}
+
+// vimWordBack is the b motion: the start of this word, or of the one before
+func vimWordBack(pos BufferPos, big bool) BufferPos {
+	pos, ok := vimPrev(pos)
+	for ok && vimClass(vimChar(pos), big) == 0 && !vimEmptyLine(pos) {
+		pos, ok = vimPrev(pos)
+	}
+	class := vimClass(vimChar(pos), big)
+	for class != 0 {
+		prev, ok := vimPrev(pos)
+		if !ok || vimClass(vimChar(prev), big) != class {
+			break
+		}
+		pos = prev
+	}
+	return pos
+}
+
+// vimWordEnd is the e motion: the end of this word, or of the next one
+func vimWordEnd(pos BufferPos, big bool) BufferPos {
+	pos, ok := vimNext(pos)
+	for ok && vimClass(vimChar(pos), big) == 0 {
+		pos, ok = vimNext(pos)
+	}
+	class := vimClass(vimChar(pos), big)
+	for class != 0 {
+		next, ok := vimNext(pos)
+		if !ok || vimClass(vimChar(next), big) != class {
+			break
+		}
+		pos = next
+	}
+	return pos
+}
+
+// vimFirstNonBlank returns the column of the first character of a line that isn't blank
+func vimFirstNonBlank(line int) int {
+	for col, char := range TEXTBUFFER[line] {
+		if !unicode.IsSpace(char) {
+			return col
+		}
+	}
+	return 0
+}
+
+// vimLastCol returns the last column the cursor can be on in normal mode
+func vimLastCol(line int) int {
+	if len(TEXTBUFFER[line]) == 0 {
+		return 0
+	}
+	return len(TEXTBUFFER[line]) - 1
+}
+
+// vimMotion works out where a motion goes from pos, repeated count times. linewise motions
+// like j and G work on whole lines after an operator, inclusive ones include the character they end on.
+// Returns false when the motion can't go anywhere, like f for a character that isn't on the line
+func vimMotion(key, char string, count int, pos BufferPos, operator bool) (target BufferPos, linewise, inclusive, ok bool) {
+	typed := count
+	if count < 1 {
+		count = 1
+	}
+	lastLine := len(TEXTBUFFER) - 1
+	target = pos
+	switch key {
+	case "h", "Left":
+		if pos.Col == 0 {
+			return pos, false, false, false
+		}
+		target.Col = maxInt(pos.Col-count, 0)
+	case "l", "Right":
+		limit := vimLastCol(pos.Line)
+		if operator {
+			limit = len(TEXTBUFFER[pos.Line])
+		}
+		if pos.Col >= limit {
+			return pos, false, false, false
+		}
+		target.Col = minInt(pos.Col+count, limit)
+	case "j", "Down", "k", "Up":
+		target.Line = pos.Line + count
+		if key == "k" || key == "Up" {
+			target.Line = pos.Line - count
+		}
+		if target.Line < 0 || target.Line > lastLine {
+			return pos, true, false, false
+		}
+		target.Col = VIM.WantCol
+		if target.Col < 0 || target.Col > vimLastCol(target.Line) {
+			target.Col = vimLastCol(target.Line)
+		}
+		return target, true, false, true
+	case "w", "W":
+		for n := 0; n < count; n++ {
+			next := vimWordStart(target, key == "W")
+			// After an operator the last word ends with its line, so dw doesn't join lines
+			if operator && next.Line > target.Line && n == count-1 {
+				next = BufferPos{target.Line, len(TEXTBUFFER[target.Line])}
+				if target.Col == next.Col && next.Line < lastLine {
+					next = BufferPos{target.Line + 1, 0}
+				}
+			}
+			target = next
+		}
+	case "b", "B":
+		for n := 0; n < count; n++ {
+			target = vimWordBack(target, key == "B")
+		}
+	case "e", "E":
+		for n := 0; n < count; n++ {
+			target = vimWordEnd(target, key == "E")
+		}
+		inclusive = true
+	case "0":
+		target.Col = 0
+	case "^":
+		target.Col = vimFirstNonBlank(pos.Line)
+	case "$":
+		target.Line = minInt(pos.Line+count-1, lastLine)
+		target.Col = vimLastCol(target.Line)
+		inclusive = len(TEXTBUFFER[target.Line]) > 0
+	case "gg", "G":
+		target.Line = 0
+		if key == "G" {
+			target.Line = lastLine
+		}
+		if typed > 0 {
+			target.Line = minInt(typed-1, lastLine)
+		}
+		target.Col = vimFirstNonBlank(target.Line)
+		return target, true, false, true
+	case "f", "F", "t", "T":
+		want := []rune(char)[0]
+		line := TEXTBUFFER[pos.Line]
+		col := pos.Col
+		for n := 0; n < count; n++ {
+			step := 1
+			if key == "F" || key == "T" {
+				step = -1
+			}
+			start := col + step
+			// Repeating t from right before the character would stay put, so it looks one further
+			if (key == "t" || key == "T") && n == 0 && start >= 0 && start < len(line) && line[start] == want {
+				start += step
+			}
+			found := -1
+			for c := start; c >= 0 && c < len(line); c += step {
+				if line[c] == want {
+					found = c
+					break
+				}
+			}
+			if found < 0 {
+				return pos, false, false, false
+			}
+			col = found
+		}
+		switch key {
+		case "t":
+			col--
+		case "T":
+			col++
+		}
+		target.Col = col
+		inclusive = key == "f" || key == "t"
+	case "{", "}":
+		step := 1
+		if key == "{" {
+			step = -1
+		}
+		line := pos.Line
+		for n := 0; n < count; n++ {
+			// Leave the empty lines the cursor is on, then stop at the next one
+			for line+step >= 0 && line+step <= lastLine && len(TEXTBUFFER[line]) == 0 {
+				line += step
+			}
+			for line+step >= 0 && line+step <= lastLine && len(TEXTBUFFER[line+step]) > 0 {
+				line += step
+			}
+			line += step
+		}
+		switch {
+		case line < 0:
+			target = BufferPos{0, 0}
+		case line > lastLine:
+			target = BufferPos{lastLine, len(TEXTBUFFER[lastLine])}
+		default:
+			target = BufferPos{line, 0}
+		}
+	default:
+		return pos, false, false, false
+	}
+	return target, false, inclusive, true
+}
+
+// vimTextObject finds the range of a text object like iw or a( around pos.
+// Returns the start and the end, which is exclusive, or false when there is none
+func vimTextObject(object string, pos BufferPos) (BufferPos, BufferPos, bool) {
+	around := object[0] == 'a'
+	kind := object[1:]
+	line := TEXTBUFFER[pos.Line]
+	switch kind {
+	case "w", "W":
+		if len(line) == 0 {
+			return pos, pos, false
+		}
+		big := kind == "W"
+		col := minInt(pos.Col, len(line)-1)
+		class := vimClass(line[col], big)
+		start, end := col, col+1
+		for start > 0 && vimClass(line[start-1], big) == class {
+			start--
+		}
+		for end < len(line) && vimClass(line[end], big) == class {
+			end++
+		}
+		if around && class == 0 && end < len(line) {
+			// aw on blanks takes the word after them
+			next := vimClass(line[end], big)
+			for end < len(line) && vimClass(line[end], big) == next {
+				end++
+			}
+		} else if around {
+			// aw takes the blanks after the word, or before it when there are none after
+			trailing := end
+			for trailing < len(line) && vimClass(line[trailing], big) == 0 {
+				trailing++
+			}
+			if trailing > end {
+				end = trailing
+			} else {
+				for start > 0 && vimClass(line[start-1], big) == 0 {
+					start--
+				}
+			}
+		}
+		return BufferPos{pos.Line, start}, BufferPos{pos.Line, end}, true
+	case "\"", "'", "`":
+		quote := []rune(kind)[0]
+		var quotes []int
+		for col, char := range line {
+			if char == quote && (col == 0 || line[col-1] != '\\') {
+				quotes = append(quotes, col)
+			}
+		}
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, closing := quotes[i], quotes[i+1]
+			// The pair around the cursor, or else the first one after it
+			if pos.Col <= closing {
+				if around {
+					return BufferPos{pos.Line, open}, BufferPos{pos.Line, closing + 1}, true
+				}
+				return BufferPos{pos.Line, open + 1}, BufferPos{pos.Line, closing}, true
+			}
+		}
+		return pos, pos, false
+	}
+
+	open, closing := vimBracketPair(kind)
+	start, ok := vimFindBracket(pos, open, closing, -1)
+	if !ok {
+		return pos, pos, false
+	}
+	end, ok := vimFindBracket(start, open, closing, 1)
+	if !ok {
+		return pos, pos, false
+	}
+	if around {
+		return start, BufferPos{end.Line, end.Col + 1}, true
+	}
+	return BufferPos{start.Line, start.Col + 1}, end, true
+}
+
+// vimBracketPair returns the brackets a text object like i( or iB stands for
+func vimBracketPair(kind string) (rune, rune) {
+	switch kind {
+	case "[", "]":
+		return '[', ']'
+	case "{", "}", "B":
+		return '{', '}'
+	case "<", ">":
+		return '<', '>'
+	}
+	return '(', ')'
+}
+
+// vimFindBracket looks for the unmatched open bracket before pos when step is -1, where a bracket under the cursor
+// belongs to the pair it opens or closes, or for the bracket closing the one at pos when step is 1
+func vimFindBracket(pos BufferPos, open, closing rune, step int) (BufferPos, bool) {
+	depth := 0
+	if step < 0 && vimChar(pos) == open {
+		return pos, true
+	}
+	ok := true
+	for {
+		if step > 0 {
+			pos, ok = vimNext(pos)
+		} else {
+			pos, ok = vimPrev(pos)
+		}
+		if !ok {
+			return pos, false
+		}
+		switch vimChar(pos) {
+		case open:
+			if step < 0 && depth == 0 {
+				return pos, true
+			}
+			if step < 0 {
+				depth--
+			} else {
+				depth++
+			}
+		case closing:
+			if step > 0 && depth == 0 {
+				return pos, true
+			}
+			if step > 0 {
+				depth--
+			} else {
+				depth++
+			}
+		}
+	}
+}
+
+// vimClampPos moves a position onto the buffer like MoveCursorTo does, for the visual anchor
+// when the buffer changed under it
+func vimClampPos(pos BufferPos) BufferPos {
+	pos.Line = maxInt(minInt(pos.Line, len(TEXTBUFFER)-1), 0)
+	pos.Col = maxInt(minInt(pos.Col, len(TEXTBUFFER[pos.Line])), 0)
+	return pos
+}
+
+// vimBefore reports whether a comes before b in the buffer
+func vimBefore(a, b BufferPos) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+}
+
+// textBetween returns the text from one position up to another, with lines separated by "\n"
+func textBetween(from, to BufferPos) string {
+	var text strings.Builder
+	for pos := from; vimBefore(pos, to); {
+		text.WriteRune(vimChar(pos))
+		next, ok := vimNext(pos)
+		if !ok {
+			break
+		}
+		pos = next
+	}
+	return text.String()
+}
+
+// deleteText deletes the text from one position up to another, recording each edit in HISTORY.
+// Returns the deleted text
+func deleteText(from, to BufferPos) string {
+	text := textBetween(from, to)
+	for range []rune(text) {
+		if from.Col < len(TEXTBUFFER[from.Line]) {
+			deleted := bufferDeleteRune(from.Line, from.Col)
+			HISTORY.Record(Edit{Kind: EditDeleteRune, Line: from.Line, Col: from.Col, Char: deleted, Before: from, After: from})
+		} else if from.Line+1 < len(TEXTBUFFER) {
+			bufferJoinLine(from.Line)
+			HISTORY.Record(Edit{Kind: EditJoinLine, Line: from.Line, Col: from.Col, Before: from, After: from})
+		}
+	}
+	return text
+}
+
+// insertText inserts text with "\n" line breaks at a position, recording each edit in HISTORY.
+// Returns the position right after the inserted text
+func insertText(at BufferPos, text string) BufferPos {
+	for _, char := range text {
+		if char == '\n' {
+			bufferSplitLine(at.Line, at.Col)
+			next := BufferPos{at.Line + 1, 0}
+			HISTORY.Record(Edit{Kind: EditSplitLine, Line: at.Line, Col: at.Col, Before: at, After: next})
+			at = next
+			continue
+		}
+		bufferInsertRune(at.Line, at.Col, char)
+		next := BufferPos{at.Line, at.Col + 1}
+		HISTORY.Record(Edit{Kind: EditInsertRune, Line: at.Line, Col: at.Col, Char: char, Before: at, After: next})
+		at = next
+	}
+	return at
+}
+
+// linesText returns whole lines of the buffer joined by "\n", for linewise yanks
+func linesText(first, last int) string {
+	lines := make([]string, 0, last-first+1)
+	for line := first; line <= last; line++ {
+		lines = append(lines, string(TEXTBUFFER[line]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deleteLines deletes whole lines, leaving one empty line when they were all of the buffer
+func deleteLines(first, last int) {
+	lastLine := len(TEXTBUFFER) - 1
+	switch {
+	case last < lastLine:
+		deleteText(BufferPos{first, 0}, BufferPos{last + 1, 0})
+	case first > 0:
+		deleteText(BufferPos{first - 1, len(TEXTBUFFER[first-1])}, BufferPos{last, len(TEXTBUFFER[last])})
+	default:
+		deleteText(BufferPos{0, 0}, BufferPos{last, len(TEXTBUFFER[last])})
+	}
+}
+
+// minInt returns the smaller of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of two ints
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// setTestBuffer fills TEXTBUFFER with lines separated by "\n"
+func setTestBuffer(text string) {
+	TEXTBUFFER = nil
+	for _, line := range strings.Split(text, "\n") {
+		TEXTBUFFER = append(TEXTBUFFER, []rune(line))
+	}
+}
+
+func TestParseVimCommand(t *testing.T) {
+	tests := []struct {
+		keys     string
+		visual   bool
+		want     vimCommand
+		complete bool
+		ok       bool
+	}{
+		{"w", false, vimCommand{Key: "w"}, true, true},
+		{"3j", false, vimCommand{Count: 3, Key: "j"}, true, true},
+		{"0", false, vimCommand{Key: "0"}, true, true},
+		{"10G", false, vimCommand{Count: 10, Key: "G"}, true, true},
+		{"g", false, vimCommand{}, false, true},
+		{"gg", false, vimCommand{Key: "gg"}, true, true},
+		{"d", false, vimCommand{Operator: "d"}, false, true},
+		{"dd", false, vimCommand{Operator: "d", Key: "d"}, true, true},
+		{"2d3w", false, vimCommand{Count: 2, Operator: "d", Key: "w", MotionCount: 3}, true, true},
+		{"ci(", false, vimCommand{Operator: "c", Key: "i("}, true, true},
+		{"ci", false, vimCommand{Operator: "c"}, false, true},
+		{"ciq", false, vimCommand{Operator: "c", Key: "iq"}, true, false},
+		{"dfx", false, vimCommand{Operator: "d", Key: "f", Char: "x"}, true, true},
+		{"rz", false, vimCommand{Key: "r", Char: "z"}, true, true},
+		{"yx", false, vimCommand{Operator: "y"}, false, false},
+		{"q", false, vimCommand{}, false, false},
+		{"iw", false, vimCommand{Key: "i"}, true, true},
+		{"iw", true, vimCommand{Key: "iw"}, true, true},
+		{"d", true, vimCommand{Key: "d"}, true, true},
+	}
+	for _, test := range tests {
+		var keys []string
+		for _, key := range test.keys {
+			keys = append(keys, string(key))
+		}
+		got, complete, ok := parseVimCommand(keys, test.visual)
+		if ok != test.ok || ok && (complete != test.complete || complete && got != test.want) {
+			t.Errorf("parseVimCommand(%q, %v) = %+v, %v, %v, want %+v, %v, %v",
+				test.keys, test.visual, got, complete, ok, test.want, test.complete, test.ok)
+		}
+	}
+}
+
+func TestVimMotion(t *testing.T) {
+	text := "foo.bar baz\n  qux_1 end\n\nlast line"
+	tests := []struct {
+		key       string
+		char      string
+		count     int
+		from      BufferPos
+		operator  bool
+		want      BufferPos
+		linewise  bool
+		inclusive bool
+		ok        bool
+	}{
+		{"w", "", 0, BufferPos{0, 0}, false, BufferPos{0, 3}, false, false, true},
+		{"W", "", 0, BufferPos{0, 0}, false, BufferPos{0, 8}, false, false, true},
+		{"w", "", 0, BufferPos{0, 8}, false, BufferPos{1, 2}, false, false, true},
+		{"w", "", 0, BufferPos{0, 8}, true, BufferPos{0, 11}, false, false, true},
+		{"w", "", 0, BufferPos{1, 8}, false, BufferPos{2, 0}, false, false, true},
+		{"w", "", 3, BufferPos{0, 0}, false, BufferPos{0, 8}, false, false, true},
+		{"b", "", 0, BufferPos{1, 2}, false, BufferPos{0, 8}, false, false, true},
+		{"B", "", 0, BufferPos{0, 6}, false, BufferPos{0, 0}, false, false, true},
+		{"e", "", 0, BufferPos{0, 0}, false, BufferPos{0, 2}, false, true, true},
+		{"E", "", 0, BufferPos{0, 0}, false, BufferPos{0, 6}, false, true, true},
+		{"h", "", 0, BufferPos{0, 0}, false, BufferPos{0, 0}, false, false, false},
+		{"l", "", 20, BufferPos{0, 0}, false, BufferPos{0, 10}, false, false, true},
+		{"l", "", 20, BufferPos{0, 0}, true, BufferPos{0, 11}, false, false, true},
+		{"j", "", 0, BufferPos{0, 4}, false, BufferPos{1, 4}, true, false, true},
+		{"k", "", 0, BufferPos{0, 4}, false, BufferPos{0, 4}, true, false, false},
+		{"^", "", 0, BufferPos{1, 6}, false, BufferPos{1, 2}, false, false, true},
+		{"$", "", 0, BufferPos{0, 0}, false, BufferPos{0, 10}, false, true, true},
+		{"gg", "", 0, BufferPos{3, 4}, false, BufferPos{0, 0}, true, false, true},
+		{"G", "", 0, BufferPos{0, 0}, false, BufferPos{3, 0}, true, false, true},
+		{"G", "", 2, BufferPos{0, 0}, false, BufferPos{1, 2}, true, false, true},
+		{"f", "b", 0, BufferPos{0, 0}, false, BufferPos{0, 4}, false, true, true},
+		{"f", "b", 2, BufferPos{0, 0}, false, BufferPos{0, 8}, false, true, true},
+		{"t", "b", 0, BufferPos{0, 0}, false, BufferPos{0, 3}, false, true, true},
+		{"F", "o", 0, BufferPos{0, 5}, false, BufferPos{0, 2}, false, false, true},
+		{"T", "o", 0, BufferPos{0, 5}, false, BufferPos{0, 3}, false, false, true},
+		{"f", "z", 2, BufferPos{0, 0}, false, BufferPos{0, 0}, false, false, false},
+		{"}", "", 0, BufferPos{0, 0}, false, BufferPos{2, 0}, false, false, true},
+		{"{", "", 0, BufferPos{3, 2}, false, BufferPos{2, 0}, false, false, true},
+	}
+	for _, test := range tests {
+		setTestBuffer(text)
+		VIM.WantCol = test.from.Col
+		got, linewise, inclusive, ok := vimMotion(test.key, test.char, test.count, test.from, test.operator)
+		if ok != test.ok || ok && (got != test.want || linewise != test.linewise || inclusive != test.inclusive) {
+			t.Errorf("vimMotion(%q %q, %d, %v, %v) = %v, %v, %v, %v, want %v, %v, %v, %v",
+				test.key, test.char, test.count, test.from, test.operator,
+				got, linewise, inclusive, ok, test.want, test.linewise, test.inclusive, test.ok)
+		}
+	}
+}
+
+func TestVimTextObject(t *testing.T) {
+	tests := []struct {
+		text   string
+		object string
+		at     BufferPos
+		want   string
+		ok     bool
+	}{
+		{"foo bar baz", "iw", BufferPos{0, 5}, "bar", true},
+		{"foo bar baz", "aw", BufferPos{0, 5}, "bar ", true},
+		{"foo bar", "aw", BufferPos{0, 5}, " bar", true},
+		{"foo.bar baz", "iW", BufferPos{0, 1}, "foo.bar", true},
+		{"foo   bar", "aw", BufferPos{0, 4}, "   bar", true},
+		{"", "iw", BufferPos{0, 0}, "", false},
+		{`x = "hello world" y`, `i"`, BufferPos{0, 8}, "hello world", true},
+		{`x = "hello world" y`, `a"`, BufferPos{0, 8}, `"hello world"`, true},
+		{`x = "hello" y`, `i"`, BufferPos{0, 0}, "hello", true},
+		{`say 'hi'`, `i'`, BufferPos{0, 6}, "hi", true},
+		{"x = y", `i"`, BufferPos{0, 0}, "", false},
+		{"f(a, (b))", "i(", BufferPos{0, 6}, "b", true},
+		{"f(a, (b))", "i(", BufferPos{0, 7}, "b", true},
+		{"f(a, (b))", "i(", BufferPos{0, 8}, "a, (b)", true},
+		{"f(a, (b))", "i(", BufferPos{0, 1}, "a, (b)", true},
+		{"f(a, (b))", "a(", BufferPos{0, 3}, "(a, (b))", true},
+		{"f(a, (b))", "ib", BufferPos{0, 2}, "a, (b)", true},
+		{"x = (y)", "i(", BufferPos{0, 6}, "y", true},
+		{"x = (y)", "i(", BufferPos{0, 0}, "", false},
+		{"a[1][2]", "i[", BufferPos{0, 5}, "2", true},
+		{"if x {\n\treturn\n}", "i{", BufferPos{1, 2}, "\n\treturn\n", true},
+		{"if x {\n\treturn\n}", "aB", BufferPos{2, 0}, "{\n\treturn\n}", true},
+		{"<a href>", "i<", BufferPos{0, 3}, "a href", true},
+		{"()", "i(", BufferPos{0, 0}, "", true},
+	}
+	for _, test := range tests {
+		setTestBuffer(test.text)
+		start, end, ok := vimTextObject(test.object, test.at)
+		if ok != test.ok {
+			t.Errorf("vimTextObject(%q) in %q at %v: ok = %v, want %v", test.object, test.text, test.at, ok, test.ok)
+			continue
+		}
+		if got := textBetween(start, end); ok && got != test.want {
+			t.Errorf("vimTextObject(%q) in %q at %v = %q, want %q", test.object, test.text, test.at, got, test.want)
+		}
+	}
+}